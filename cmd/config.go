@@ -0,0 +1,371 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"ruijie-go/internal/client"
+	"ruijie-go/internal/config"
+	"ruijie-go/internal/models"
+	"ruijie-go/internal/utils"
+	"ruijie-go/internal/vault"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	configInitForce    bool
+	configInitNoVerify bool
+	configGetReveal    bool
+)
+
+// configCmd represents the config command
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Create, inspect and check the config file",
+	Long: `Create, inspect and check the YAML config file.
+
+Examples:
+  ruijie-go config init
+  ruijie-go config get service
+  ruijie-go config set retry.attempts 5
+  ruijie-go config set service_aliases.dx 中国电信
+  ruijie-go config set profiles.lab.interface eth1
+  ruijie-go config validate
+  ruijie-go config schema > ruijie-go.schema.json`,
+}
+
+var configInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Create the config file interactively",
+	Long: `Ask for the username, password and service, verify the credentials with a
+CAS login without going online, and write the config file with 0600
+permissions. The password is stored in the credential vault, in the config
+file or not at all.`,
+	Args: cobra.NoArgs,
+	RunE: runConfigInit,
+}
+
+var configGetCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "Print the effective value of a setting",
+	Long: `Print the effective value of a setting after merging the config file, the
+selected profile, environment variables and flags. The password is masked
+unless --reveal is given.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runConfigGet,
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Change a setting in the config file",
+	Long: `Change a setting in the config file, keeping its comments. Keys are dotted,
+e.g. portal.base_url, service_aliases.dx or profiles.lab.service. Lists are
+given comma-separated, durations like 30s.`,
+	Args: cobra.ExactArgs(2),
+	RunE: runConfigSet,
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the config file",
+	Long: `Check the config file for YAML errors, unknown keys, values of the wrong
+type, service names missing from the cached service list and unreadable
+credential sources. Exits with status 1 if an error was found.`,
+	Args: cobra.NoArgs,
+	RunE: runConfigValidate,
+}
+
+var configSchemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the JSON Schema of the config file",
+	Long: `Print a JSON Schema of the config file for editors. With the YAML language
+server, add this first line to the config file:
+
+  # yaml-language-server: $schema=/path/to/ruijie-go.schema.json`,
+	Args: cobra.NoArgs,
+	RunE: runConfigSchema,
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configInitCmd, configGetCmd, configSetCmd, configValidateCmd, configSchemaCmd)
+
+	// A broken config file must not lock out the commands that fix it
+	configCmd.PersistentPreRunE = setupLogging
+
+	configInitCmd.Flags().BoolVar(&configInitForce, "force", false, "Overwrite an existing config file")
+	configInitCmd.Flags().BoolVar(&configInitNoVerify, "no-verify", false, "Skip the CAS login, e.g. off campus")
+	configGetCmd.Flags().BoolVar(&configGetReveal, "reveal", false, "Print secrets such as the password")
+}
+
+func runConfigInit(cmd *cobra.Command, args []string) error {
+	path := configFilePath()
+	if _, err := os.Stat(path); err == nil && !configInitForce {
+		return fmt.Errorf("%s already exists, use --force to overwrite it or \"ruijie-go config set\" to change it", path)
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	username, err := promptLine(reader, "Username", viper.GetString("username"))
+	if err != nil {
+		return err
+	}
+	if username == "" {
+		return errors.New("username must not be empty")
+	}
+
+	password, servicesData, err := verifyCredentials(cmd, username)
+	if err != nil {
+		return err
+	}
+
+	// Select the service from the live list if the login provided one
+	var service string
+	if servicesData != nil && len(servicesData.Services) > 0 {
+		fmt.Println()
+		if service, err = utils.InteractiveServiceSelection(servicesData, nil); err != nil {
+			return err
+		}
+	} else if service, err = promptLine(reader, "Service", "校园网"); err != nil {
+		return err
+	}
+
+	fmt.Println("\nHow should the password be stored?")
+	fmt.Println("  1. Encrypted vault, unlocked with a passphrase")
+	fmt.Println("  2. Encrypted vault, unlocked with this machine's key (for daemons)")
+	fmt.Println("  3. Plain text in the config file")
+	fmt.Println("  4. Do not store it")
+	choice, err := promptLine(reader, "Choice", "1")
+	if err != nil {
+		return err
+	}
+
+	settings := []config.FileValue{{Key: "username", Value: username}}
+	switch choice {
+	case "1":
+		err = storeInVault(username, password, vault.KeyPassphrase)
+	case "2":
+		err = storeInVault(username, password, vault.KeyMachine)
+	case "3":
+		settings = append(settings, config.FileValue{Key: "password", Value: password})
+	case "4":
+	default:
+		err = fmt.Errorf("invalid choice %q", choice)
+	}
+	if err != nil {
+		return err
+	}
+	settings = append(settings, config.FileValue{Key: "service", Value: service})
+
+	// Replaces the file of --force in one step, a failed write keeps the old one
+	if err := config.WriteFileValues(path, settings); err != nil {
+		return err
+	}
+
+	fmt.Printf("\nWrote %s\n", path)
+	fmt.Println("Log in with: ruijie-go login")
+	return nil
+}
+
+// verifyCredentials asks for the password until a CAS login accepts it and
+// returns it with the service list of the account. While online the portal
+// shows no login form, then the password is taken unverified.
+func verifyCredentials(cmd *cobra.Command, username string) (string, *models.ServiceList, error) {
+	cfg := config.NewConfig()
+	cfg.LoadFromViper()
+	cfg.UpdateFromFlags(username, "", "", viper.GetString("proxy"), viper.GetBool("verbose"))
+	ruijieClient := newRuijieClient(cfg)
+
+	online := false
+	if !configInitNoVerify {
+		ctx, cancel := commandContext(cmd, cfg)
+		isLoggedIn, _, err := ruijieClient.CheckLoginStatus(ctx)
+		cancel()
+		if err != nil {
+			return "", nil, reportError(cfg, fmt.Errorf("cannot reach the portal, use --no-verify off campus: %w", err))
+		}
+		online = isLoggedIn
+	}
+
+	const maxAttempts = 3
+	for attempt := 1; ; attempt++ {
+		password, err := config.PromptSecret("Password: ")
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to read password: %w", err)
+		}
+		if password == "" {
+			return "", nil, errors.New("password must not be empty")
+		}
+		if configInitNoVerify {
+			return password, nil, nil
+		}
+		if online {
+			fmt.Println("Already online, the password cannot be verified until you log out")
+		} else {
+			fmt.Println("Verifying the credentials...")
+		}
+
+		ctx, cancel := commandContext(cmd, cfg)
+		servicesData, err := ruijieClient.GetAvailableServices(ctx, func() (string, string, error) {
+			return username, password, nil
+		})
+		cancel()
+		switch {
+		case err == nil:
+			return password, servicesData, nil
+		case errors.Is(err, client.ErrBadCredentials) && attempt < maxAttempts:
+			fmt.Printf("Error: %s\n", config.GetErrorMessage(err))
+		default:
+			return "", nil, reportError(cfg, err)
+		}
+	}
+}
+
+// storeInVault saves the password in the credential vault, creating it locked with key
+func storeInVault(username, password, key string) error {
+	path, err := vaultPath()
+	if err != nil {
+		return err
+	}
+
+	v, err := openVault(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		var passphrase string
+		if passphrase, err = newVaultPassphrase(key); err == nil {
+			v, err = vault.New(path, key, passphrase)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	v.Set(username, password)
+	if err := v.Save(); err != nil {
+		return err
+	}
+	fmt.Printf("Stored the password in %s (key: %s)\n", path, v.Key)
+	return nil
+}
+
+// promptLine asks for a line of input, an empty answer selects the default
+func promptLine(reader *bufio.Reader, prompt, defaultValue string) (string, error) {
+	if defaultValue != "" {
+		fmt.Printf("%s [%s]: ", prompt, defaultValue)
+	} else {
+		fmt.Printf("%s: ", prompt)
+	}
+
+	line, err := reader.ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("failed to read %s: %w", strings.ToLower(prompt), err)
+	}
+	if line = strings.TrimSpace(line); line == "" {
+		return defaultValue, nil
+	}
+	return line, nil
+}
+
+func runConfigGet(cmd *cobra.Command, args []string) error {
+	key := strings.ToLower(args[0])
+	setting, ok := config.LookupSetting(key)
+	if !ok && !viper.IsSet(key) {
+		return fmt.Errorf("unknown key %q, see \"ruijie-go config schema\"", key)
+	}
+	if err := config.ApplyProfile(); err != nil {
+		return err
+	}
+
+	value := viper.Get(key)
+	switch {
+	case value == nil:
+		return nil
+	case setting.Secret && !configGetReveal && fmt.Sprint(value) != "":
+		fmt.Println("********")
+	case isScalar(value):
+		fmt.Println(value)
+	default:
+		// Sections and lists are printed as YAML
+		encoder := yaml.NewEncoder(os.Stdout)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(value); err != nil {
+			return err
+		}
+		return encoder.Close()
+	}
+
+	return nil
+}
+
+// isScalar reports whether a config value prints on a single line
+func isScalar(value interface{}) bool {
+	switch value.(type) {
+	case map[string]interface{}, []interface{}, []int, []string:
+		return false
+	}
+	return true
+}
+
+func runConfigSet(cmd *cobra.Command, args []string) error {
+	key := strings.ToLower(args[0])
+	setting, ok := config.LookupSetting(key)
+	if !ok {
+		return fmt.Errorf("unknown key %q, see \"ruijie-go config schema\"", key)
+	}
+	value, err := setting.ParseValue(args[1])
+	if err != nil {
+		return err
+	}
+
+	path := configFilePath()
+	if err := config.SetFileValue(path, key, value); err != nil {
+		return err
+	}
+	if setting.Secret {
+		fmt.Println("Note: the password is stored in plain text, consider \"ruijie-go credentials set\"")
+	}
+
+	fmt.Printf("Set %s in %s\n", key, path)
+	return nil
+}
+
+func runConfigValidate(cmd *cobra.Command, args []string) error {
+	path := configFilePath()
+	cfg := config.NewConfig()
+	cfg.LoadFromViper()
+
+	problems, err := config.ValidateFile(path, cfg.CachedServices())
+	if err != nil {
+		cmd.SilenceUsage = true
+		return err
+	}
+
+	errorCount := 0
+	for _, problem := range problems {
+		fmt.Println(problem)
+		if !problem.Warning {
+			errorCount++
+		}
+	}
+	if errorCount > 0 {
+		// The problems are already explained, they are not usage errors
+		cmd.SilenceUsage = true
+		return fmt.Errorf("%s has %d error(s)", path, errorCount)
+	}
+
+	fmt.Printf("%s is valid\n", path)
+	return nil
+}
+
+func runConfigSchema(cmd *cobra.Command, args []string) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(config.JSONSchema())
+}
@@ -0,0 +1,293 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"ruijie-go/internal/config"
+	"ruijie-go/internal/vault"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/term"
+)
+
+var (
+	credentialsUsername string
+	credentialsKey      string
+	credentialsReveal   bool
+)
+
+// credentialsCmd represents the credentials command
+var credentialsCmd = &cobra.Command{
+	Use:   "credentials",
+	Short: "Manage the encrypted credential vault",
+	Long: `Store passwords in an encrypted vault instead of the config file or
+RUIJIE_PASSWORD. Commands read the password of the configured username from
+the vault, or the only stored account when no username is configured.
+
+The vault is encrypted with AES-256-GCM under a key derived with PBKDF2 from
+either a passphrase or this machine's identity:
+
+  passphrase  asked for when needed, or read from RUIJIE_VAULT_PASSPHRASE
+  machine     no passphrase, for unattended daemons; the file only opens on
+              this machine for this user
+
+The vault location is set with "vault" in the config file or RUIJIE_VAULT,
+"none" disables it.
+
+Examples:
+  ruijie-go credentials set -u 1145141919810
+  ruijie-go credentials set -u 1145141919810 --key machine
+  pass show ysu | ruijie-go credentials set -u 1145141919810
+  ruijie-go credentials show
+  ruijie-go credentials rm 1145141919810`,
+}
+
+var credentialsSetCmd = &cobra.Command{
+	Use:   "set",
+	Short: "Store a password in the vault",
+	Long: `Store the password of a username in the vault, creating the vault if needed.
+The password is prompted for, or read from the first line of stdin when it is
+not a terminal. --key changes how the vault is locked.`,
+	Args: cobra.NoArgs,
+	RunE: runCredentialsSet,
+}
+
+var credentialsShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "List the accounts in the vault",
+	Args:  cobra.NoArgs,
+	RunE:  runCredentialsShow,
+}
+
+var credentialsRmCmd = &cobra.Command{
+	Use:   "rm [username]",
+	Short: "Remove an account from the vault",
+	Long: `Remove the password of a username from the vault. Without a username the
+only stored account is removed. The vault file is deleted once it is empty.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runCredentialsRm,
+}
+
+func init() {
+	rootCmd.AddCommand(credentialsCmd)
+	credentialsCmd.AddCommand(credentialsSetCmd, credentialsShowCmd, credentialsRmCmd)
+
+	credentialsSetCmd.Flags().StringVarP(&credentialsUsername, "username", "u", "", "Username the password belongs to (default is the configured username)")
+	credentialsSetCmd.Flags().StringVar(&credentialsKey, "key", "", "Lock the vault with a passphrase or the machine key: passphrase or machine (default keeps the current, passphrase for a new vault)")
+	credentialsShowCmd.Flags().BoolVar(&credentialsReveal, "reveal", false, "Print the passwords")
+}
+
+func runCredentialsSet(cmd *cobra.Command, args []string) error {
+	path, err := vaultPath()
+	if err != nil {
+		return err
+	}
+
+	// Open the vault, or create it locked with the selected key
+	v, err := openVault(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		key := credentialsKey
+		if key == "" {
+			key = vault.KeyPassphrase
+		}
+		var passphrase string
+		if passphrase, err = newVaultPassphrase(key); err == nil {
+			v, err = vault.New(path, key, passphrase)
+		}
+	} else if err == nil && credentialsKey != "" && credentialsKey != v.Key {
+		var passphrase string
+		if passphrase, err = newVaultPassphrase(credentialsKey); err == nil {
+			err = v.SetKey(credentialsKey, passphrase)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	username := credentialsUsername
+	if username == "" {
+		username = viper.GetString("username")
+	}
+	if username == "" {
+		fmt.Print("Username: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("failed to read username: %w", err)
+		}
+		username = strings.TrimSpace(line)
+	}
+	if username == "" {
+		return errors.New("username must not be empty")
+	}
+
+	password, err := readNewPassword()
+	if err != nil {
+		return err
+	}
+
+	v.Set(username, password)
+	if err := v.Save(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Stored the password of %s in %s (key: %s)\n", username, path, v.Key)
+	return nil
+}
+
+func runCredentialsShow(cmd *cobra.Command, args []string) error {
+	path, err := vaultPath()
+	if err != nil {
+		return err
+	}
+	v, err := openVault(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		fmt.Printf("No credential vault at %s\n", path)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Vault: %s\n", path)
+	fmt.Printf("Key: %s\n", v.Key)
+	credentials := v.Credentials()
+	if len(credentials) == 0 {
+		fmt.Println("No accounts stored")
+		return nil
+	}
+	fmt.Println("Accounts:")
+	for _, credential := range credentials {
+		password := "********"
+		if credentialsReveal {
+			password = credential.Password
+		}
+		fmt.Printf("  %s: %s (updated %s)\n", credential.Username, password, credential.UpdatedAt.Format("2006-01-02 15:04:05"))
+	}
+
+	return nil
+}
+
+func runCredentialsRm(cmd *cobra.Command, args []string) error {
+	path, err := vaultPath()
+	if err != nil {
+		return err
+	}
+	v, err := openVault(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("no credential vault at %s", path)
+	}
+	if err != nil {
+		return err
+	}
+
+	username := ""
+	if len(args) > 0 {
+		username = args[0]
+	}
+	credential, ok := v.Get(username)
+	if !ok {
+		if username == "" {
+			return errors.New("the vault holds several accounts, name the one to remove")
+		}
+		return fmt.Errorf("no password stored for %s", username)
+	}
+	v.Remove(credential.Username)
+
+	if len(v.Credentials()) == 0 {
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to delete credential vault: %w", err)
+		}
+		fmt.Printf("Removed %s, the vault was empty and has been deleted\n", credential.Username)
+		return nil
+	}
+	if err := v.Save(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Removed %s\n", credential.Username)
+	return nil
+}
+
+// vaultPath returns the configured vault location
+func vaultPath() (string, error) {
+	cfg := config.NewConfig()
+	cfg.LoadFromViper()
+	if cfg.VaultFile == "" {
+		return "", errors.New("the credential vault is disabled (vault: none)")
+	}
+	return cfg.VaultFile, nil
+}
+
+// openVault unlocks the vault at path, asking for the passphrase if it is not in the environment
+func openVault(path string) (*vault.Vault, error) {
+	key, err := vault.KeySource(path)
+	if err != nil {
+		return nil, err
+	}
+
+	passphrase := os.Getenv(config.VaultPassphraseEnv)
+	if key == vault.KeyPassphrase && passphrase == "" {
+		if passphrase, err = config.PromptSecret("Vault passphrase: "); err != nil {
+			return nil, fmt.Errorf("failed to read vault passphrase: %w", err)
+		}
+	}
+	return vault.Open(path, passphrase)
+}
+
+// newVaultPassphrase asks for a new passphrase twice if key is vault.KeyPassphrase
+func newVaultPassphrase(key string) (string, error) {
+	if key != vault.KeyPassphrase {
+		return "", nil
+	}
+	if passphrase := os.Getenv(config.VaultPassphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+
+	passphrase, err := config.PromptSecret("New vault passphrase: ")
+	if err != nil {
+		return "", fmt.Errorf("failed to read vault passphrase: %w", err)
+	}
+	repeated, err := config.PromptSecret("Repeat vault passphrase: ")
+	if err != nil {
+		return "", fmt.Errorf("failed to read vault passphrase: %w", err)
+	}
+	if passphrase != repeated {
+		return "", errors.New("the passphrases do not match")
+	}
+	return passphrase, nil
+}
+
+// readNewPassword prompts for the password twice, or reads one line from stdin when piped
+func readNewPassword() (string, error) {
+	var password string
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		var err error
+		if password, err = config.PromptSecret("Password: "); err != nil {
+			return "", fmt.Errorf("failed to read password: %w", err)
+		}
+		repeated, err := config.PromptSecret("Repeat password: ")
+		if err != nil {
+			return "", fmt.Errorf("failed to read password: %w", err)
+		}
+		if password != repeated {
+			return "", errors.New("the passwords do not match")
+		}
+	} else {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("failed to read password from stdin: %w", err)
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+
+	if password == "" {
+		return "", errors.New("password must not be empty")
+	}
+	return password, nil
+}
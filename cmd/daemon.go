@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"ruijie-go/internal/config"
+	"ruijie-go/internal/utils"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	daemonUsername      string
+	daemonPassword      string
+	daemonPasswordStdin bool
+	daemonService       string
+	daemonInterval      time.Duration
+	daemonMinBackoff    time.Duration
+	daemonMaxBackoff    time.Duration
+)
+
+// daemonCmd represents the daemon command
+var daemonCmd = &cobra.Command{
+	Use:     "daemon",
+	Aliases: []string{"watch"},
+	Short:   "Keep the network session alive",
+	Long: `Periodically check the login status and log in again when the session drops.
+
+Failed checks and logins are retried with exponential backoff. The daemon
+stops cleanly on SIGINT or SIGTERM, cancelling any login in progress. The
+global --timeout applies to each check-and-login round. Progress is logged
+at info level unless --log-level says otherwise.
+
+Examples:
+  ruijie-go daemon
+  ruijie-go daemon -s telecom --interval 30s
+  ruijie-go watch --max-backoff 5m`,
+	RunE: runDaemon,
+}
+
+func init() {
+	rootCmd.AddCommand(daemonCmd)
+
+	daemonCmd.Flags().StringVarP(&daemonUsername, "username", "u", "", "Username for authentication")
+	daemonCmd.Flags().StringVarP(&daemonPassword, "password", "p", "", "Password for authentication, visible in ps and shell history (prefer --password-stdin)")
+	daemonCmd.Flags().BoolVar(&daemonPasswordStdin, "password-stdin", false, "Read the password from the first line of stdin")
+	daemonCmd.MarkFlagsMutuallyExclusive("password", "password-stdin")
+	daemonCmd.Flags().StringVarP(&daemonService, "service", "s", "", "Service name, number from \"ruijie-go services\", alias or pinyin such as dianxin")
+	daemonCmd.Flags().DurationVar(&daemonInterval, "interval", time.Minute, "Interval between status checks while online")
+	daemonCmd.Flags().DurationVar(&daemonMinBackoff, "min-backoff", 5*time.Second, "Initial retry delay after a failure")
+	daemonCmd.Flags().DurationVar(&daemonMaxBackoff, "max-backoff", 10*time.Minute, "Maximum retry delay after repeated failures")
+
+	// The daemon reports its progress through the logger, so show info by default
+	daemonCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		if !viper.GetBool("verbose") {
+			viper.SetDefault("log_level", "info")
+		}
+		return setupCommand(cmd, args)
+	}
+}
+
+func runDaemon(cmd *cobra.Command, args []string) error {
+	// Create configuration
+	cfg := config.NewConfig()
+	cfg.LoadFromViper()
+	password, err := passwordFlag(daemonPassword, daemonPasswordStdin)
+	if err != nil {
+		return err
+	}
+	cfg.UpdateFromFlags(daemonUsername, password, daemonService, viper.GetString("proxy"), viper.GetBool("verbose"))
+	serviceName := cfg.ResolveServiceName(daemonService)
+
+	// Credentials are collected once up front, the loop itself never prompts
+	if !cfg.ValidateCredentials() {
+		if err := cfg.GetCredentialsInteractive(); err != nil {
+			return fmt.Errorf("failed to get credentials: %w", err)
+		}
+	}
+
+	// Nobody is watching the terminal of a daemon
+	if cfg.Captcha.Solver == "interactive" {
+		cfg.Captcha.Solver = "none"
+	}
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	backoff := utils.Backoff{Base: daemonMinBackoff, Max: daemonMaxBackoff, Jitter: 0.2}
+	logger.Info("Keepalive started", "username", cfg.Username, "service", serviceName, "interval", daemonInterval)
+
+	for {
+		delay := daemonInterval
+
+		// A fresh client per round picks up the session saved by the previous round
+		// or by other commands
+		ruijieClient := newRuijieClient(cfg)
+		roundCtx, cancel := daemonRoundContext(ctx, cfg.Timeout)
+
+		isLoggedIn, _, err := ruijieClient.CheckLoginStatus(roundCtx)
+		switch {
+		case err != nil:
+			delay = backoff.Next()
+			logger.Warn("Status check failed", "error", config.GetErrorMessage(err), "retryIn", delay.Round(time.Second))
+		case isLoggedIn:
+			backoff.Reset()
+		default:
+			logger.Info("Session dropped, logging in", "service", serviceName)
+			if err := ruijieClient.Login(roundCtx, cfg.Username, cfg.Password, serviceName); err != nil {
+				delay = backoff.Next()
+				logger.Warn("Login failed", "error", config.GetErrorMessage(err), "retryIn", delay.Round(time.Second))
+			} else {
+				backoff.Reset()
+				logger.Info("Login successful", "service", serviceName)
+			}
+		}
+		cancel()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			logger.Info("Received stop signal, exiting")
+			return nil
+		case <-timer.C:
+		}
+	}
+}
+
+// daemonRoundContext bounds a single check-and-login round by the command timeout
+func daemonRoundContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
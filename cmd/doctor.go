@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"ruijie-go/internal/client"
+	"ruijie-go/internal/config"
+	"ruijie-go/internal/utils"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// doctorCmd represents the doctor command
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Diagnose network and portal problems",
+	Long: `Check the way to the portal step by step and suggest a remedy for every
+problem found:
+
+  interface  the interface (--interface) or any interface has an IPv4 address
+  gateway    the routing table has a default route (Linux only)
+  dns        the portal host resolves
+  tcp        the portal accepts TCP connections
+  tls        the TLS handshake and certificate are valid
+  proxy      portal requests are not sent through a proxy
+  hijack     plain HTTP requests are redirected to the portal before login
+  cas-sso    the login page still carries p#login-croypto
+  clock      the system clock matches the portal's
+
+The command exits with status 1 if any check failed. With --output json or
+yaml a document with the fields portal, ok and checks is printed.`,
+	RunE: runDoctor,
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+}
+
+func runDoctor(cmd *cobra.Command, args []string) error {
+	// Create configuration
+	cfg := config.NewConfig()
+	cfg.LoadFromViper()
+	cfg.UpdateFromFlags("", "", "", viper.GetString("proxy"), viper.GetBool("verbose"))
+
+	ctx, cancel := commandContext(cmd, cfg)
+	defer cancel()
+
+	// Create Ruijie client
+	ruijieClient := newRuijieClient(cfg)
+
+	// Run the checks
+	report := utils.DoctorReport{Portal: ruijieClient.Portal().BaseURL, OK: true, Checks: []utils.CheckReport{}}
+	failures := 0
+	for _, check := range ruijieClient.Diagnose(ctx) {
+		if check.Status == client.CheckFail {
+			failures++
+			report.OK = false
+		}
+		report.Checks = append(report.Checks, utils.CheckReport{
+			Name:   check.Name,
+			Status: check.Status,
+			Detail: check.Detail,
+			Hint:   check.Hint,
+		})
+	}
+
+	if cfg.Output != utils.OutputText {
+		if err := utils.WriteOutput(os.Stdout, cfg.Output, report); err != nil {
+			return err
+		}
+	} else {
+		utils.PrintDoctorReport(report)
+	}
+
+	if failures > 0 {
+		// Failed checks are already explained, they are not usage errors
+		cmd.SilenceUsage = true
+		return fmt.Errorf("%d of %d checks failed", failures, len(report.Checks))
+	}
+
+	return nil
+}
@@ -2,8 +2,8 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 
-	"ruijie-go/internal/client"
 	"ruijie-go/internal/config"
 	"ruijie-go/internal/utils"
 
@@ -15,8 +15,11 @@ import (
 var infoCmd = &cobra.Command{
 	Use:   "info",
 	Short: "Show account information",
-	Long:  `Show detailed account information for the current logged-in user.`,
-	RunE:  runInfo,
+	Long: `Show detailed account information for the current logged-in user.
+
+With --output json or yaml a document with a "status" section (as printed by
+the status command) and an "account" section is printed.`,
+	RunE: runInfo,
 }
 
 func init() {
@@ -29,39 +32,37 @@ func runInfo(cmd *cobra.Command, args []string) error {
 	cfg.LoadFromViper()
 	cfg.UpdateFromFlags("", "", "", viper.GetString("proxy"), viper.GetBool("verbose"))
 
+	ctx, cancel := commandContext(cmd, cfg)
+	defer cancel()
+
 	// Create Ruijie client
-	ruijieClient := client.NewRuijieClient(cfg.Proxies, cfg.Verbose)
+	ruijieClient := newRuijieClient(cfg)
 
 	// First check if logged in
-	isLoggedIn, userInfo, err := ruijieClient.CheckLoginStatus()
+	isLoggedIn, userInfo, err := ruijieClient.CheckLoginStatus(ctx)
 	if err != nil {
-		fmt.Printf("Error: %s\n", config.GetErrorMessage(err))
-		return err
+		return reportError(cfg, err)
 	}
 
 	if !isLoggedIn {
-		fmt.Println("Error: Not logged in. Please login first.")
-		return fmt.Errorf("not logged in")
+		return reportError(cfg, fmt.Errorf("not logged in, please login first"))
 	}
 
-	// Get session information
-	sessionInfo, err := ruijieClient.RedirectToPortal("")
+	// Get account information
+	accountInfo, err := ruijieClient.CurrentAccountInfo(ctx)
 	if err != nil {
-		fmt.Printf("Error: %s\n", config.GetErrorMessage(err))
-		return err
+		return reportError(cfg, err)
 	}
 
-	// Get account information
-	accountInfo, err := ruijieClient.GetAccountInfo(sessionInfo)
-	if err != nil {
-		fmt.Printf("Error: %s\n", config.GetErrorMessage(err))
-		return err
+	if cfg.Output != utils.OutputText {
+		return utils.WriteOutput(os.Stdout, cfg.Output, utils.InfoReport{
+			Status:  utils.NewStatusReport(isLoggedIn, userInfo),
+			Account: utils.NewAccountReport(accountInfo),
+		})
 	}
 
 	// Print user status information
-	if userInfoMap, ok := userInfo.(map[string]interface{}); ok {
-		utils.PrintStatusInfo(userInfoMap)
-	}
+	utils.PrintStatusInfo(userInfo)
 	fmt.Println()
 
 	// Print account information
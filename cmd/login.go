@@ -3,7 +3,6 @@ package cmd
 import (
 	"fmt"
 
-	"ruijie-go/internal/client"
 	"ruijie-go/internal/config"
 	"ruijie-go/internal/utils"
 
@@ -12,9 +11,10 @@ import (
 )
 
 var (
-	loginUsername string
-	loginPassword string
-	loginService  string
+	loginUsername      string
+	loginPassword      string
+	loginPasswordStdin bool
+	loginService       string
 )
 
 // loginCmd represents the login command
@@ -25,7 +25,9 @@ var loginCmd = &cobra.Command{
 
 Examples:
   ruijie-go login -u 1145141919810 -p mypassword
+  pass show ysu | ruijie-go login -u 1145141919810 --password-stdin
   ruijie-go login -s campus
+  ruijie-go login -s  # Pick a service interactively, see also "ruijie-go services"
   ruijie-go login  # Interactive login`,
 	RunE: runLogin,
 }
@@ -34,15 +36,21 @@ func init() {
 	rootCmd.AddCommand(loginCmd)
 
 	loginCmd.Flags().StringVarP(&loginUsername, "username", "u", "", "Username for authentication")
-	loginCmd.Flags().StringVarP(&loginPassword, "password", "p", "", "Password for authentication")
-	loginCmd.Flags().StringVarP(&loginService, "service", "s", "", "Service name. Supports aliases: campus/1=校园网, unicom/2=中国联通, telecom/3=中国电信, mobile/4=中国移动")
+	loginCmd.Flags().StringVarP(&loginPassword, "password", "p", "", "Password for authentication, visible in ps and shell history (prefer --password-stdin)")
+	loginCmd.Flags().BoolVar(&loginPasswordStdin, "password-stdin", false, "Read the password from the first line of stdin")
+	loginCmd.MarkFlagsMutuallyExclusive("password", "password-stdin")
+	loginCmd.Flags().StringVarP(&loginService, "service", "s", "", "Service name, number from \"ruijie-go services\", alias or pinyin such as dianxin (empty value selects interactively)")
 }
 
 func runLogin(cmd *cobra.Command, args []string) error {
 	// Create configuration
 	cfg := config.NewConfig()
 	cfg.LoadFromViper()
-	cfg.UpdateFromFlags(loginUsername, loginPassword, loginService, viper.GetString("proxy"), viper.GetBool("verbose"))
+	password, err := passwordFlag(loginPassword, loginPasswordStdin)
+	if err != nil {
+		return err
+	}
+	cfg.UpdateFromFlags(loginUsername, password, loginService, viper.GetString("proxy"), viper.GetBool("verbose"))
 
 	// Handle service selection
 	serviceName := cfg.Service
@@ -51,22 +59,17 @@ func runLogin(cmd *cobra.Command, args []string) error {
 		if cmd.Flags().Changed("service") && loginService == "" {
 			fmt.Println("Fetching available services...")
 
-			// Get credentials first if not provided
-			if !cfg.ValidateCredentials() {
-				if err := cfg.GetCredentialsInteractive(); err != nil {
-					return fmt.Errorf("failed to get credentials: %w", err)
-				}
-			}
-
 			// Create client and get services
-			ruijieClient := client.NewRuijieClient(cfg.Proxies, cfg.Verbose)
-			servicesData, err := ruijieClient.GetAvailableServices(cfg.Username, cfg.Password)
+			ctx, cancel := commandContext(cmd, cfg)
+			ruijieClient := newRuijieClient(cfg)
+			servicesData, err := ruijieClient.GetAvailableServices(ctx, credentialsPrompt(cfg))
+			cancel()
 			if err != nil {
 				return fmt.Errorf("failed to get available services: %w", err)
 			}
 
 			// Interactive service selection
-			selectedService, err := utils.InteractiveServiceSelection(servicesData)
+			selectedService, err := utils.InteractiveServiceSelection(servicesData, cfg.ServiceResolver())
 			if err != nil {
 				return fmt.Errorf("service selection failed: %w", err)
 			}
@@ -89,15 +92,19 @@ func runLogin(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	ctx, cancel := commandContext(cmd, cfg)
+	defer cancel()
+
 	// Create Ruijie client
-	ruijieClient := client.NewRuijieClient(cfg.Proxies, cfg.Verbose)
+	ruijieClient := newRuijieClient(cfg)
 
 	// Execute login
-	if err := ruijieClient.Login(cfg.Username, cfg.Password, serviceName); err != nil {
-		fmt.Printf("Error: %s\n", config.GetErrorMessage(err))
-		return err
+	if err := ruijieClient.Login(ctx, cfg.Username, cfg.Password, serviceName); err != nil {
+		return reportError(cfg, err)
 	}
 
+	// The login refreshed the service cache, numbers and aliases resolve now
+	serviceName = cfg.ResolveServiceName(serviceName)
 	fmt.Printf("Login successful to service: %s\n", serviceName)
 	return nil
 }
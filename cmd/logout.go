@@ -3,7 +3,6 @@ package cmd
 import (
 	"fmt"
 
-	"ruijie-go/internal/client"
 	"ruijie-go/internal/config"
 
 	"github.com/spf13/cobra"
@@ -28,13 +27,15 @@ func runLogout(cmd *cobra.Command, args []string) error {
 	cfg.LoadFromViper()
 	cfg.UpdateFromFlags("", "", "", viper.GetString("proxy"), viper.GetBool("verbose"))
 
+	ctx, cancel := commandContext(cmd, cfg)
+	defer cancel()
+
 	// Create Ruijie client
-	ruijieClient := client.NewRuijieClient(cfg.Proxies, cfg.Verbose)
+	ruijieClient := newRuijieClient(cfg)
 
 	// Execute logout
-	if err := ruijieClient.Logout(); err != nil {
-		fmt.Printf("Error: %s\n", config.GetErrorMessage(err))
-		return err
+	if err := ruijieClient.Logout(ctx); err != nil {
+		return reportError(cfg, err)
 	}
 
 	fmt.Println("Logout successful.")
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"ruijie-go/internal/mockportal"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	mockListen      string
+	mockUsername    string
+	mockPassword    string
+	mockServices    []string
+	mockCaptchaCode string
+	mockDelay       time.Duration
+	mockFailures    []string
+)
+
+// mockPortalCmd represents the mock-portal command
+var mockPortalCmd = &cobra.Command{
+	Use:    "mock-portal",
+	Short:  "Run a fake Ruijie portal for development",
+	Hidden: true,
+	Long: `Run a local fake Ruijie V2 portal for testing and offline development.
+
+The server emulates the portal redirect, the cas-sso login page with AES key
+check, the workflow nodes and the eportal API. Point the client at it with
+--portal-url.
+
+Failures are scripted with --fail endpoint=mode[:times], where times limits
+how many responses are affected (default: all).
+
+Endpoints: redirect, cas-sso, getCurrentNode, serviceSelection, serviceLogin,
+           userOnline, getAccountInfo, offline, getOnlineUserInfo, * (all)
+Modes:     wrong-password, captcha, expired (cas-sso only),
+           unknown-node, stuck-node (getCurrentNode only),
+           slow, malformed-json, 5xx
+
+Examples:
+  ruijie-go mock-portal --listen 127.0.0.1:8080
+  ruijie-go mock-portal --fail serviceLogin=5xx:2 --fail cas-sso=captcha:1
+  ruijie-go --portal-url http://127.0.0.1:8080 --state-file none login -u test -p test`,
+	RunE: runMockPortal,
+}
+
+func init() {
+	rootCmd.AddCommand(mockPortalCmd)
+
+	mockPortalCmd.Flags().StringVar(&mockListen, "listen", "127.0.0.1:8080", "Address to listen on")
+	mockPortalCmd.Flags().StringVar(&mockUsername, "username", "test", "Accepted username")
+	mockPortalCmd.Flags().StringVar(&mockPassword, "password", "test", "Accepted password")
+	mockPortalCmd.Flags().StringSliceVar(&mockServices, "services", nil, "Offered services (default 校园网,中国联通,中国电信,中国移动)")
+	mockPortalCmd.Flags().StringVar(&mockCaptchaCode, "captcha-code", "1234", "Captcha code expected when a captcha is shown")
+	mockPortalCmd.Flags().DurationVar(&mockDelay, "delay", 3*time.Second, "Delay of the slow failure mode")
+	mockPortalCmd.Flags().StringArrayVar(&mockFailures, "fail", nil, "Failure rule endpoint=mode[:times], repeatable")
+}
+
+func runMockPortal(cmd *cobra.Command, args []string) error {
+	server := mockportal.New(mockportal.Options{
+		Username:    mockUsername,
+		Password:    mockPassword,
+		Services:    mockServices,
+		CaptchaCode: mockCaptchaCode,
+		Delay:       mockDelay,
+	})
+	for _, spec := range mockFailures {
+		rule, err := mockportal.ParseRule(spec)
+		if err != nil {
+			return err
+		}
+		server.AddRule(rule)
+	}
+
+	listener, err := net.Listen("tcp", mockListen)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", mockListen, err)
+	}
+	server.Start(listener)
+	defer server.Close()
+
+	fmt.Printf("Mock portal listening on %s\n", server.URL)
+	fmt.Printf("Credentials: %s / %s, captcha code: %s\n", mockUsername, mockPassword, mockCaptchaCode)
+	fmt.Printf("Try: ruijie-go --portal-url %s --state-file none login -u %s -p %s\n", server.URL, mockUsername, mockPassword)
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+
+	fmt.Println("Mock portal stopped")
+	return nil
+}
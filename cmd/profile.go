@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"ruijie-go/internal/config"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// profileCmd represents the profile command
+var profileCmd = &cobra.Command{
+	Use:   "profile",
+	Short: "List and select config profiles",
+	Long: `Profiles are named sections of the config file, each holding its own
+username, credential source, service, proxy, interface and portal endpoints:
+
+  profile: personal
+  profiles:
+    personal:
+      username: "1145141919810"
+      service: 校园网
+    lab:
+      username: lab-shared
+      password_command: pass show lab
+      service: 中国电信
+      interface: eth1
+
+The profile is selected with --profile, RUIJIE_PROFILE or the profile key.
+Its settings override the rest of the config file, environment variables
+and flags override the profile.
+
+Examples:
+  ruijie-go profile list
+  ruijie-go profile use lab
+  ruijie-go --profile personal status`,
+}
+
+var profileListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the profiles of the config file",
+	Args:  cobra.NoArgs,
+	RunE:  runProfileList,
+}
+
+var profileUseCmd = &cobra.Command{
+	Use:   "use <profile>",
+	Short: "Set the default profile in the config file",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runProfileUse,
+}
+
+func init() {
+	rootCmd.AddCommand(profileCmd)
+	profileCmd.AddCommand(profileListCmd, profileUseCmd)
+
+	// An unknown profile must not lock out the command that fixes it
+	profileCmd.PersistentPreRunE = setupLogging
+}
+
+func runProfileList(cmd *cobra.Command, args []string) error {
+	profiles := config.Profiles()
+	if len(profiles) == 0 {
+		fmt.Printf("No profiles defined in %s\n", configFilePath())
+		return nil
+	}
+
+	active := strings.ToLower(viper.GetString("profile"))
+	fmt.Println("Profiles:")
+	for _, profile := range profiles {
+		marker := " "
+		if profile.Name == active {
+			marker = "*"
+		}
+		fmt.Printf("%s %s", marker, profile.Name)
+		if profile.Username != "" {
+			fmt.Printf(" - %s", profile.Username)
+		}
+		if profile.Service != "" {
+			fmt.Printf(" (%s)", profile.Service)
+		}
+		fmt.Println()
+	}
+
+	return nil
+}
+
+func runProfileUse(cmd *cobra.Command, args []string) error {
+	name := strings.ToLower(args[0])
+	found := false
+	for _, profile := range config.Profiles() {
+		found = found || profile.Name == name
+	}
+	if !found {
+		return fmt.Errorf("unknown profile %q, see \"ruijie-go profile list\"", name)
+	}
+
+	path := configFilePath()
+	if err := config.SetFileValue(path, "profile", name); err != nil {
+		return err
+	}
+
+	fmt.Printf("Default profile set to %s in %s\n", name, path)
+	return nil
+}
@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"ruijie-go/internal/config"
+	"ruijie-go/internal/mockportal"
+	"ruijie-go/internal/utils"
+)
+
+// startPortal runs a mock portal with the given failure rules and isolates
+// the commands from the config, vault and state files of the user
+func startPortal(t *testing.T, rules ...string) *mockportal.Server {
+	t.Helper()
+
+	home := t.TempDir()
+	for _, env := range []string{"HOME", "XDG_CONFIG_HOME", "XDG_STATE_HOME", "XDG_CACHE_HOME", "XDG_RUNTIME_DIR"} {
+		t.Setenv(env, home)
+	}
+	t.Setenv("RUIJIE_VAULT", "none")
+	t.Setenv("RUIJIE_SERVICE_CACHE", "none")
+	t.Setenv("RUIJIE_RETRY_ATTEMPTS", "2")
+	t.Setenv("RUIJIE_RETRY_BACKOFF", "1ms")
+	t.Setenv("RUIJIE_RETRY_MAX_BACKOFF", "1ms")
+
+	portal := mockportal.New(mockportal.Options{Delay: time.Second})
+	for _, spec := range rules {
+		rule, err := mockportal.ParseRule(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		portal.AddRule(rule)
+	}
+	portal.Start(nil)
+	t.Cleanup(portal.Close)
+	return portal
+}
+
+// execute runs a command line against the portal and returns its exit code.
+// Flags keep their values between runs, so every run sets all the flags it
+// relies on.
+func execute(t *testing.T, portal *mockportal.Server, args ...string) int {
+	t.Helper()
+
+	// Flags in args come last and win over these
+	rootCmd.SetArgs(append([]string{
+		"--portal-url", portal.URL,
+		"--state-file", "none",
+		"--captcha-solver", "none",
+		"--output", utils.OutputText,
+		"--timeout", "10s",
+		"--step-timeout", "300ms",
+		"--log-level", "error",
+	}, args...))
+	// Usage and cobra's copy of the error only add noise to the test log
+	rootCmd.SetErr(io.Discard)
+	return config.ExitCode(Execute())
+}
+
+// captureStdout returns what fn writes to stdout
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	output := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(r)
+		output <- data
+	}()
+	fn()
+	w.Close()
+	return string(<-output)
+}
+
+func TestLoginCommand(t *testing.T) {
+	portal := startPortal(t)
+
+	if code := execute(t, portal, "login", "-u", "test", "-p", "test", "-s", "dianxin"); code != config.ExitOK {
+		t.Fatalf("login exited with %d", code)
+	}
+	if online, service := portal.Online(); !online || service != "中国电信" {
+		t.Errorf("portal reports online=%v service=%q, want online to 中国电信", online, service)
+	}
+}
+
+func TestLogoutCommand(t *testing.T) {
+	portal := startPortal(t)
+	if code := execute(t, portal, "login", "-u", "test", "-p", "test", "-s", "校园网"); code != config.ExitOK {
+		t.Fatalf("login exited with %d", code)
+	}
+
+	if code := execute(t, portal, "logout"); code != config.ExitOK {
+		t.Fatalf("logout exited with %d", code)
+	}
+	if online, _ := portal.Online(); online {
+		t.Error("portal still reports the user online")
+	}
+}
+
+func TestSwitchCommand(t *testing.T) {
+	portal := startPortal(t)
+	if code := execute(t, portal, "login", "-u", "test", "-p", "test", "-s", "校园网"); code != config.ExitOK {
+		t.Fatalf("login exited with %d", code)
+	}
+
+	if code := execute(t, portal, "switch", "-u", "test", "-p", "test", "中国联通"); code != config.ExitOK {
+		t.Fatalf("switch exited with %d", code)
+	}
+	if _, service := portal.Online(); service != "中国联通" {
+		t.Errorf("portal reports service %q, want 中国联通", service)
+	}
+}
+
+func TestStatusCommand(t *testing.T) {
+	portal := startPortal(t)
+
+	status := func() utils.StatusReport {
+		t.Helper()
+		var code int
+		output := captureStdout(t, func() {
+			code = execute(t, portal, "status", "--output", utils.OutputJSON)
+		})
+		if code != config.ExitOK {
+			t.Fatalf("status exited with %d", code)
+		}
+
+		var report utils.StatusReport
+		if err := json.Unmarshal([]byte(output), &report); err != nil {
+			t.Fatalf("status printed invalid JSON %q: %v", output, err)
+		}
+		return report
+	}
+
+	if report := status(); report.Online {
+		t.Errorf("status before login = %+v, want offline", report)
+	}
+	if code := execute(t, portal, "login", "-u", "test", "-p", "test", "-s", "中国移动"); code != config.ExitOK {
+		t.Fatalf("login exited with %d", code)
+	}
+	if report := status(); !report.Online || report.Service != "中国移动" || report.Username != "test" {
+		t.Errorf("status after login = %+v, want test online to 中国移动", report)
+	}
+}
+
+func TestLoginCommandFailures(t *testing.T) {
+	tests := []struct {
+		rule string
+		code int
+	}{
+		{"cas-sso=" + mockportal.FailWrongPassword, config.ExitBadCredentials},
+		{"cas-sso=" + mockportal.FailCaptcha, config.ExitCaptchaRequired},
+		{"cas-sso=" + mockportal.FailExpired, config.ExitUnexpectedSchema},
+		{"serviceLogin=" + mockportal.FailSlow, config.ExitPortalUnreachable},
+		{"serviceLogin=" + mockportal.FailMalformedJSON, config.ExitUnexpectedSchema},
+		{"serviceLogin=" + mockportal.FailServerError, config.ExitPortalUnreachable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			portal := startPortal(t, tt.rule)
+			if code := execute(t, portal, "login", "-u", "test", "-p", "test", "-s", "校园网"); code != tt.code {
+				t.Errorf("login exited with %d, want %d", code, tt.code)
+			}
+			if online, _ := portal.Online(); online {
+				t.Error("portal reports the user online")
+			}
+		})
+	}
+}
+
+func TestServicesCommand(t *testing.T) {
+	portal := startPortal(t)
+
+	services := func(args ...string) string {
+		t.Helper()
+		var code int
+		output := captureStdout(t, func() {
+			code = execute(t, portal, append([]string{"services", "--output", utils.OutputJSON}, args...)...)
+		})
+		if code != config.ExitOK {
+			t.Fatalf("services %v exited with %d", args, code)
+		}
+		return output
+	}
+
+	// Offline the list needs a CAS login
+	if output := services("-u", "test", "-p", "test"); !strings.Contains(output, "中国电信") {
+		t.Errorf("services printed %q, want the service list", output)
+	}
+
+	// Online it needs no credentials, there is no terminal to ask for them
+	if code := execute(t, portal, "login", "-u", "test", "-p", "test", "-s", "校园网"); code != config.ExitOK {
+		t.Fatalf("login exited with %d", code)
+	}
+	if output := services("-u", "", "-p", ""); !strings.Contains(output, "中国电信") {
+		t.Errorf("services printed %q, want the service list", output)
+	}
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"ruijie-go/internal/config"
+	"ruijie-go/internal/utils"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	servicesUsername      string
+	servicesPassword      string
+	servicesPasswordStdin bool
+)
+
+// servicesCmd represents the services command
+var servicesCmd = &cobra.Command{
+	Use:   "services",
+	Short: "List available services",
+	Long: `List the network services the portal offers to the current account.
+
+While online the current portal session is used. While offline the command
+performs a CAS login (without selecting a service) to query the list, so
+credentials are required.
+
+With --output json or yaml a document with a "services" list is printed, each
+entry having the fields index, name, id, available and default.
+
+Examples:
+  ruijie-go services
+  ruijie-go services -o json`,
+	RunE: runServices,
+}
+
+func init() {
+	rootCmd.AddCommand(servicesCmd)
+
+	servicesCmd.Flags().StringVarP(&servicesUsername, "username", "u", "", "Username for authentication (only needed while offline)")
+	servicesCmd.Flags().StringVarP(&servicesPassword, "password", "p", "", "Password for authentication, visible in ps and shell history (prefer --password-stdin) (only needed while offline)")
+	servicesCmd.Flags().BoolVar(&servicesPasswordStdin, "password-stdin", false, "Read the password from the first line of stdin")
+	servicesCmd.MarkFlagsMutuallyExclusive("password", "password-stdin")
+}
+
+func runServices(cmd *cobra.Command, args []string) error {
+	// Create configuration
+	cfg := config.NewConfig()
+	cfg.LoadFromViper()
+	password, err := passwordFlag(servicesPassword, servicesPasswordStdin)
+	if err != nil {
+		return err
+	}
+	cfg.UpdateFromFlags(servicesUsername, password, "", viper.GetString("proxy"), viper.GetBool("verbose"))
+
+	// Create Ruijie client
+	ruijieClient := newRuijieClient(cfg)
+
+	ctx, cancel := commandContext(cmd, cfg)
+	defer cancel()
+
+	services, err := ruijieClient.GetAvailableServices(ctx, credentialsPrompt(cfg))
+	if err != nil {
+		return reportError(cfg, err)
+	}
+
+	if cfg.Output != utils.OutputText {
+		return utils.WriteOutput(os.Stdout, cfg.Output, utils.NewServicesReport(services))
+	}
+
+	utils.PrintServicesList(services, cfg.ServiceResolver())
+	return nil
+}
+
+// credentialsPrompt returns the configured credentials and asks for those that
+// are missing, only when a command actually needs them
+func credentialsPrompt(cfg *config.Config) func() (string, string, error) {
+	return func() (string, string, error) {
+		if !cfg.ValidateCredentials() {
+			if err := cfg.GetCredentialsInteractive(); err != nil {
+				return "", "", fmt.Errorf("failed to get credentials: %w", err)
+			}
+		}
+		return cfg.Username, cfg.Password, nil
+	}
+}
@@ -2,8 +2,8 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 
-	"ruijie-go/internal/client"
 	"ruijie-go/internal/config"
 	"ruijie-go/internal/utils"
 
@@ -15,8 +15,11 @@ import (
 var statusCmd = &cobra.Command{
 	Use:   "status",
 	Short: "Check login status",
-	Long:  `Check the current login status of the Ruijie network authentication system.`,
-	RunE:  runStatus,
+	Long: `Check the current login status of the Ruijie network authentication system.
+
+With --output json or yaml a document with the fields online, username,
+service, ip, login_time and location is printed.`,
+	RunE: runStatus,
 }
 
 func init() {
@@ -29,22 +32,24 @@ func runStatus(cmd *cobra.Command, args []string) error {
 	cfg.LoadFromViper()
 	cfg.UpdateFromFlags("", "", "", viper.GetString("proxy"), viper.GetBool("verbose"))
 
+	ctx, cancel := commandContext(cmd, cfg)
+	defer cancel()
+
 	// Create Ruijie client
-	ruijieClient := client.NewRuijieClient(cfg.Proxies, cfg.Verbose)
+	ruijieClient := newRuijieClient(cfg)
 
 	// Check login status
-	isLoggedIn, info, err := ruijieClient.CheckLoginStatus()
+	isLoggedIn, info, err := ruijieClient.CheckLoginStatus(ctx)
 	if err != nil {
-		fmt.Printf("Error: %s\n", config.GetErrorMessage(err))
-		return err
+		return reportError(cfg, err)
+	}
+
+	if cfg.Output != utils.OutputText {
+		return utils.WriteOutput(os.Stdout, cfg.Output, utils.NewStatusReport(isLoggedIn, info))
 	}
 
 	if isLoggedIn {
-		if userInfo, ok := info.(map[string]interface{}); ok {
-			utils.PrintStatusInfo(userInfo)
-		} else {
-			fmt.Println("Online (status information unavailable)")
-		}
+		utils.PrintStatusInfo(info)
 	} else {
 		fmt.Println("Offline")
 	}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"fmt"
+
+	"ruijie-go/internal/config"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	switchUsername      string
+	switchPassword      string
+	switchPasswordStdin bool
+)
+
+// switchCmd represents the switch command
+var switchCmd = &cobra.Command{
+	Use:   "switch <service>",
+	Short: "Switch to another service",
+	Long: `Switch the current session to another service without a manual logout.
+
+The current service is read from the portal. If it differs from the requested
+one, the session goes offline and a full login to the new service follows.
+Should that login fail, the previous service is logged in again.
+
+The service accepts the same numbers, names and aliases as "login -s".
+
+Examples:
+  ruijie-go switch 中国电信
+  ruijie-go switch dianxin
+  ruijie-go switch 2`,
+	Args: cobra.ExactArgs(1),
+	RunE: runSwitch,
+}
+
+func init() {
+	rootCmd.AddCommand(switchCmd)
+
+	switchCmd.Flags().StringVarP(&switchUsername, "username", "u", "", "Username for authentication")
+	switchCmd.Flags().StringVarP(&switchPassword, "password", "p", "", "Password for authentication, visible in ps and shell history (prefer --password-stdin)")
+	switchCmd.Flags().BoolVar(&switchPasswordStdin, "password-stdin", false, "Read the password from the first line of stdin")
+	switchCmd.MarkFlagsMutuallyExclusive("password", "password-stdin")
+}
+
+func runSwitch(cmd *cobra.Command, args []string) error {
+	// Create configuration
+	cfg := config.NewConfig()
+	cfg.LoadFromViper()
+	password, err := passwordFlag(switchPassword, switchPasswordStdin)
+	if err != nil {
+		return err
+	}
+	cfg.UpdateFromFlags(switchUsername, password, "", viper.GetString("proxy"), viper.GetBool("verbose"))
+	serviceName := cfg.ResolveServiceName(args[0])
+
+	// Credentials are needed for the login after going offline
+	if !cfg.ValidateCredentials() {
+		if err := cfg.GetCredentialsInteractive(); err != nil {
+			return fmt.Errorf("failed to get credentials: %w", err)
+		}
+	}
+
+	ctx, cancel := commandContext(cmd, cfg)
+	defer cancel()
+
+	// Create Ruijie client
+	ruijieClient := newRuijieClient(cfg)
+
+	// Execute switch
+	from, to, err := ruijieClient.SwitchService(ctx, cfg.Username, cfg.Password, serviceName)
+	if err != nil {
+		return reportError(cfg, err)
+	}
+
+	switch from {
+	case "":
+		fmt.Printf("Login successful to service: %s\n", to)
+	case to:
+		fmt.Printf("Already using service: %s\n", to)
+	default:
+		fmt.Printf("Switched from %s to %s\n", from, to)
+	}
+	return nil
+}
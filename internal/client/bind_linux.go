@@ -0,0 +1,26 @@
+package client
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// bindToInterface sets SO_BINDTODEVICE so traffic leaves through the interface
+// regardless of the routing table
+func bindToInterface(dialer *net.Dialer, name string) error {
+	dialer.Control = func(network, address string, conn syscall.RawConn) error {
+		var bindErr error
+		err := conn.Control(func(fd uintptr) {
+			bindErr = syscall.BindToDevice(int(fd), name)
+		})
+		if err != nil {
+			return err
+		}
+		if bindErr != nil {
+			return fmt.Errorf("failed to bind to interface %s (needs CAP_NET_RAW on older kernels, try --source-ip): %w", name, bindErr)
+		}
+		return nil
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+//go:build !linux
+
+package client
+
+import (
+	"fmt"
+	"net"
+)
+
+// bindToInterface uses the interface's IPv4 address as the source address,
+// as binding to a device is only available on Linux
+func bindToInterface(dialer *net.Dialer, name string) error {
+	if dialer.LocalAddr != nil {
+		return nil
+	}
+
+	ip, err := interfaceIPv4(name)
+	if err != nil {
+		return err
+	}
+	dialer.LocalAddr = &net.TCPAddr{IP: ip}
+
+	return nil
+}
+
+// interfaceIPv4 returns the first IPv4 address of an interface
+func interfaceIPv4(name string) (net.IP, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+			return ipNet.IP, nil
+		}
+	}
+	return nil, fmt.Errorf("interface %s has no IPv4 address", name)
+}
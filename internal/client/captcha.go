@@ -0,0 +1,60 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// maxCaptchaAttempts bounds how often a CAS login is resubmitted with a new captcha
+const maxCaptchaAttempts = 3
+
+// CaptchaSolver turns a captcha image into the code the user would type
+type CaptchaSolver interface {
+	SolveCaptcha(ctx context.Context, image []byte) (string, error)
+}
+
+// WithCaptchaSolver sets the solver used when the CAS page demands a captcha
+func WithCaptchaSolver(solver CaptchaSolver) Option {
+	return func(r *RuijieClient) {
+		r.captchaSolver = solver
+	}
+}
+
+// findCaptchaImage returns the absolute URL of the captcha image shown on a
+// cas-sso page, or "" when the page does not ask for a captcha
+func findCaptchaImage(doc *goquery.Document, pageURL *url.URL) string {
+	img := doc.Find("img#captcha-img, img.captcha-img, img[src*='captcha']").First()
+	if img.Length() == 0 {
+		return ""
+	}
+
+	// The image is part of the template and only revealed once required
+	hidden := "[style*='display:none'], [style*='display: none'], .hidden, [hidden]"
+	if img.Is(hidden) || img.ParentsFiltered(hidden).Length() > 0 {
+		return ""
+	}
+
+	src, ok := img.Attr("src")
+	if !ok || src == "" {
+		return ""
+	}
+	ref, err := url.Parse(src)
+	if err != nil {
+		return ""
+	}
+
+	return pageURL.ResolveReference(ref).String()
+}
+
+// captchaPayload builds the plaintext of the encrypted captcha_payload field
+func captchaPayload(code string) string {
+	if code == "" {
+		return "{}"
+	}
+
+	payload, _ := json.Marshal(map[string]string{"captcha_code": code})
+	return string(payload)
+}
@@ -0,0 +1,80 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"ruijie-go/internal/client"
+	"ruijie-go/internal/mockportal"
+)
+
+// scriptedCaptcha answers captchas with its codes in turn, repeating the last one
+type scriptedCaptcha struct {
+	codes []string
+	err   error
+	calls int
+}
+
+func (c *scriptedCaptcha) SolveCaptcha(ctx context.Context, imageData []byte) (string, error) {
+	c.calls++
+	if c.err != nil {
+		return "", c.err
+	}
+	return c.codes[min(c.calls, len(c.codes))-1], nil
+}
+
+var errSolverCrashed = errors.New("solver exited with status 1")
+
+func TestCaptchaLoop(t *testing.T) {
+	tests := []struct {
+		name   string
+		solver *scriptedCaptcha // Nil for no solver
+		kind   error            // Nil when the login succeeds
+		calls  int              // Expected solver calls
+	}{
+		{"solved", &scriptedCaptcha{codes: []string{"1234"}}, nil, 1},
+		{"rejected once", &scriptedCaptcha{codes: []string{"0000", "1234"}}, nil, 2},
+		{"always rejected", &scriptedCaptcha{codes: []string{"0000"}}, client.ErrCaptchaRequired, 3},
+		{"solver fails", &scriptedCaptcha{err: errSolverCrashed}, client.ErrCaptchaUnsolved, 1},
+		{"no solver", nil, client.ErrCaptchaRequired, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Every login page asks for a captcha
+			portal := startPortal(t, "cas-sso="+mockportal.FailCaptcha)
+			var opts []client.Option
+			if tt.solver != nil {
+				opts = append(opts, client.WithCaptchaSolver(tt.solver))
+			}
+
+			err := newClient(portal, opts...).Login(context.Background(), "test", "test", "校园网")
+			if tt.kind == nil && err != nil {
+				t.Fatalf("Login: %v", err)
+			}
+			if tt.kind != nil && !errors.Is(err, tt.kind) {
+				t.Fatalf("Login error = %v, want %v", err, tt.kind)
+			}
+			if online, _ := portal.Online(); online != (tt.kind == nil) {
+				t.Errorf("portal reports online=%v", online)
+			}
+			if tt.solver != nil && tt.solver.calls != tt.calls {
+				t.Errorf("solver called %d times, want %d", tt.solver.calls, tt.calls)
+			}
+		})
+	}
+}
+
+func TestCaptchaSolverError(t *testing.T) {
+	portal := startPortal(t, "cas-sso="+mockportal.FailCaptcha)
+	solver := &scriptedCaptcha{err: errSolverCrashed}
+
+	err := newClient(portal, client.WithCaptchaSolver(solver)).Login(context.Background(), "test", "test", "校园网")
+	if !errors.Is(err, errSolverCrashed) {
+		t.Errorf("Login error = %v, want the solver error", err)
+	}
+	if errors.Is(err, client.ErrCaptchaRequired) {
+		t.Errorf("solver failure %v is reported as a rejected captcha", err)
+	}
+}
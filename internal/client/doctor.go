@@ -0,0 +1,361 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Check statuses reported by Diagnose
+const (
+	CheckPass = "pass"
+	CheckWarn = "warn"
+	CheckFail = "fail"
+	CheckSkip = "skip"
+)
+
+// CheckResult is the outcome of one diagnostic check
+type CheckResult struct {
+	Name   string // Short name of the check, e.g. "dns"
+	Status string // One of the Check* statuses
+	Detail string // What was observed
+	Hint   string // Suggested remedy, empty if nothing needs to be done
+}
+
+// hijackProbeURL is a plain HTTP page outside the campus network. Before login
+// the campus gateway answers requests to it with a redirect to the portal.
+const hijackProbeURL = "http://www.msftconnecttest.com/connecttest.txt"
+
+// hijackProbeContent is the body of hijackProbeURL when it is not intercepted
+const hijackProbeContent = "Microsoft Connect Test"
+
+// maxClockSkew is the largest difference to the portal's clock considered sane
+const maxClockSkew = 2 * time.Minute
+
+// Errors of the platform specific defaultGateway
+var (
+	errNoDefaultRoute   = errors.New("no default route")
+	errRouteUnsupported = errors.New("reading the routing table is only supported on Linux")
+)
+
+// Diagnose checks the way to the portal step by step: interface, gateway,
+// DNS, TCP and TLS, proxy settings, HTTP hijacking, the cas-sso login page
+// and the system clock. Checks depending on a failed one are skipped.
+func (r *RuijieClient) Diagnose(ctx context.Context) []CheckResult {
+	host, port, err := r.portal.Address()
+	if err != nil {
+		return []CheckResult{failed("portal", err.Error(), "Check the portal base URL in the configuration.")}
+	}
+
+	results := []CheckResult{r.checkInterface(), r.checkGateway()}
+
+	dns := r.checkDNS(ctx, host)
+	results = append(results, dns)
+
+	tcp := skipped("tcp", "DNS resolution failed")
+	if dns.Status == CheckPass {
+		tcp = r.checkTCP(ctx, host, port)
+	}
+	results = append(results, tcp)
+
+	tlsResult := skipped("tls", "no TCP connection to the portal")
+	if tcp.Status == CheckPass {
+		tlsResult = r.checkTLS(ctx, host, port)
+	}
+	results = append(results, tlsResult, r.checkProxy(), r.checkHijack(ctx, host))
+
+	cas := skipped("cas-sso", "no TCP connection to the portal")
+	var portalDate time.Time
+	if tcp.Status == CheckPass {
+		cas, portalDate = r.checkCasSSOPage(ctx)
+	}
+	results = append(results, cas, checkClock(portalDate, tlsResult))
+
+	return results
+}
+
+// checkInterface checks that the configured interface, or any interface, has a usable IPv4 address
+func (r *RuijieClient) checkInterface() CheckResult {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return failed("interface", err.Error(), "")
+	}
+
+	var found []string
+	sourceFound := false
+	for _, iface := range ifaces {
+		if r.iface != "" && iface.Name != r.iface {
+			continue
+		}
+		if r.iface == "" && (iface.Flags&net.FlagLoopback != 0 || iface.Flags&net.FlagUp == 0) {
+			continue
+		}
+		if iface.Flags&net.FlagUp == 0 {
+			return failed("interface", fmt.Sprintf("interface %s is down", iface.Name), "Bring the interface up and connect the cable or campus Wi-Fi.")
+		}
+
+		addrs, _ := iface.Addrs()
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok || ipNet.IP.To4() == nil || ipNet.IP.IsLinkLocalUnicast() {
+				continue
+			}
+			found = append(found, iface.Name+" "+ipNet.IP.String())
+			if ipNet.IP.String() == r.sourceIP {
+				sourceFound = true
+			}
+		}
+	}
+
+	switch {
+	case r.iface != "" && len(found) == 0 && !hasInterface(ifaces, r.iface):
+		return failed("interface", fmt.Sprintf("interface %s not found", r.iface), "List the interfaces with 'ip link' and fix --interface.")
+	case len(found) == 0:
+		return failed("interface", "no IPv4 address", "Connect to the campus network and wait for DHCP, or renew the lease.")
+	case r.sourceIP != "" && !sourceFound:
+		return failed("interface", fmt.Sprintf("source IP %s is not assigned to %s", r.sourceIP, strings.Join(found, ", ")), "Fix --source-ip, it must be an address of this machine.")
+	}
+	return passed("interface", strings.Join(found, ", "))
+}
+
+// hasInterface reports whether an interface with the given name exists
+func hasInterface(ifaces []net.Interface, name string) bool {
+	for _, iface := range ifaces {
+		if iface.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// checkGateway checks that the routing table has a default route
+func (r *RuijieClient) checkGateway() CheckResult {
+	gateway, device, err := defaultGateway()
+	switch {
+	case errors.Is(err, errRouteUnsupported):
+		return skipped("gateway", err.Error())
+	case errors.Is(err, errNoDefaultRoute):
+		return failed("gateway", err.Error(), "Connect to the campus network, DHCP should provide a default gateway.")
+	case err != nil:
+		return failed("gateway", err.Error(), "")
+	}
+
+	detail := fmt.Sprintf("%s via %s", gateway, device)
+	if r.iface != "" && device != r.iface {
+		return warned("gateway", detail, fmt.Sprintf("The default route does not use %s, make sure it has a route to the portal.", r.iface))
+	}
+	return passed("gateway", detail)
+}
+
+// checkDNS resolves the portal host
+func (r *RuijieClient) checkDNS(ctx context.Context, host string) CheckResult {
+	if net.ParseIP(host) != nil {
+		return passed("dns", host+" is an IP address")
+	}
+
+	ctx, cancel := r.stepContext(ctx)
+	defer cancel()
+
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return failed("dns", err.Error(), "The portal host is only resolvable by the campus DNS servers. Use the DNS servers from DHCP instead of a custom or VPN resolver.")
+	}
+	return passed("dns", fmt.Sprintf("%s resolves to %s", host, strings.Join(addrs, ", ")))
+}
+
+// dialPortal opens a direct TCP connection to the portal, bound like portal requests
+func (r *RuijieClient) dialPortal(ctx context.Context, host, port string) (net.Conn, error) {
+	dialer := &net.Dialer{}
+	if err := r.bindDialer(dialer); err != nil {
+		return nil, err
+	}
+	return dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+}
+
+// checkTCP connects to the portal
+func (r *RuijieClient) checkTCP(ctx context.Context, host, port string) CheckResult {
+	ctx, cancel := r.stepContext(ctx)
+	defer cancel()
+
+	started := time.Now()
+	conn, err := r.dialPortal(ctx, host, port)
+	if err != nil {
+		return failed("tcp", err.Error(), "The portal is not reachable. Connect to the campus network, disable VPNs and check the firewall.")
+	}
+	defer conn.Close()
+
+	return passed("tcp", fmt.Sprintf("connected to %s in %s", conn.RemoteAddr(), time.Since(started).Round(time.Millisecond)))
+}
+
+// checkTLS performs a TLS handshake with the portal and verifies its certificate
+func (r *RuijieClient) checkTLS(ctx context.Context, host, port string) CheckResult {
+	if !strings.HasPrefix(r.portal.BaseURL, "https://") {
+		return skipped("tls", "the portal uses plain HTTP")
+	}
+
+	ctx, cancel := r.stepContext(ctx)
+	defer cancel()
+
+	conn, err := r.dialPortal(ctx, host, port)
+	if err != nil {
+		return failed("tls", err.Error(), "")
+	}
+	defer conn.Close()
+
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: host})
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		var invalid x509.CertificateInvalidError
+		if errors.As(err, &invalid) && invalid.Reason == x509.Expired {
+			return failed("tls", err.Error(), "The certificate looks expired or not yet valid, check the system clock.")
+		}
+		return failed("tls", err.Error(), "Something between you and the portal intercepts TLS. Check proxies, VPNs and security software.")
+	}
+
+	state := tlsConn.ConnectionState()
+	cert := state.PeerCertificates[0]
+	return passed("tls", fmt.Sprintf("%s, certificate valid until %s", tls.VersionName(state.Version), cert.NotAfter.Format("2006-01-02")))
+}
+
+// checkProxy reports whether portal requests go through a proxy
+func (r *RuijieClient) checkProxy() CheckResult {
+	proxy := proxyFunc(r.proxies)
+	if proxy == nil {
+		return passed("proxy", "portal requests connect directly")
+	}
+
+	req, err := http.NewRequest(http.MethodGet, r.portal.BaseURL, nil)
+	if err != nil {
+		return failed("proxy", err.Error(), "")
+	}
+	proxyURL, err := proxy(req)
+	switch {
+	case err != nil:
+		return failed("proxy", err.Error(), "Fix the proxy URL or use --proxy direct.")
+	case proxyURL == nil:
+		return passed("proxy", "the portal is excluded from the configured proxy")
+	}
+	return warned("proxy", "portal requests go through "+proxyURL.Redacted(), "The portal must be reached from the campus network directly. Add its host to NO_PROXY or use --proxy direct.")
+}
+
+// checkHijack requests a plain HTTP page outside the campus network and
+// reports whether the gateway redirects it to the portal
+func (r *RuijieClient) checkHijack(ctx context.Context, portalHost string) CheckResult {
+	ctx, cancel := r.stepContext(ctx)
+	defer cancel()
+
+	httpClient := &http.Client{
+		Transport: r.newTransport(),
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, hijackProbeURL, nil)
+	if err != nil {
+		return failed("hijack", err.Error(), "")
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return warned("hijack", err.Error(), "Before login the campus network redirects HTTP requests to the portal. Check the interface, gateway and DNS.")
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	answer := resp.Header.Get("Location") + string(body)
+	switch {
+	case strings.Contains(answer, "redirect.jsp") || strings.Contains(answer, portalHost):
+		return passed("hijack", "HTTP requests are redirected to the portal, a login is needed")
+	case resp.StatusCode == http.StatusOK && strings.Contains(answer, hijackProbeContent):
+		return passed("hijack", "HTTP requests are not redirected, internet access works")
+	}
+	return warned("hijack", fmt.Sprintf("unexpected answer %s from %s", resp.Status, hijackProbeURL), "Another captive portal, proxy or filter intercepts HTTP requests.")
+}
+
+// checkCasSSOPage fetches the cas-sso login page of a fresh portal session
+// and checks that it still carries the AES key. The Date header of the
+// answer is returned for the clock check.
+func (r *RuijieClient) checkCasSSOPage(ctx context.Context) (CheckResult, time.Time) {
+	// Without a session, e.g. when already online, the bare login page is checked
+	casSSOURL := r.portal.CasSSOURL()
+	if finalURL, err := r.followPortalRedirect(ctx, r.portal.RedirectURL); err == nil && strings.Contains(finalURL, "portal-main") {
+		if sessionInfo, err := parseSessionInfo(finalURL); err == nil {
+			casSSOURL = r.casSSOLoginURL(sessionInfo)
+		}
+	}
+
+	ctx, cancel := r.stepContext(ctx)
+	defer cancel()
+
+	resp, err := r.client.R().SetContext(ctx).Get(casSSOURL)
+	if err != nil {
+		return failed("cas-sso", err.Error(), "The login page could not be loaded. Check the portal URL and the checks above."), time.Time{}
+	}
+	date, _ := http.ParseTime(resp.Header().Get("Date"))
+	if err := serverError("failed to fetch cas-sso page", resp); err != nil {
+		return failed("cas-sso", err.Error(), "The portal has server problems, try again later."), date
+	}
+
+	if pageURL := resp.RawResponse.Request.URL.String(); strings.Contains(pageURL, "auth-success") || strings.Contains(pageURL, "ticket=") {
+		return skipped("cas-sso", "the CAS session is still valid, no login form was shown"), date
+	}
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(resp.String()))
+	if err != nil {
+		return failed("cas-sso", err.Error(), ""), date
+	}
+	hint := "The portal login page changed. Capture a run with --har and report an issue."
+	if strings.TrimSpace(doc.Find("p#login-croypto").Text()) == "" {
+		return failed("cas-sso", "p#login-croypto not found on the login page", hint), date
+	}
+	if strings.TrimSpace(doc.Find("p#login-page-flowkey").Text()) == "" {
+		return failed("cas-sso", "p#login-page-flowkey not found on the login page", hint), date
+	}
+	return passed("cas-sso", "login page carries p#login-croypto and p#login-page-flowkey"), date
+}
+
+// checkClock compares the system clock with the portal's Date header
+func checkClock(portalDate time.Time, tlsResult CheckResult) CheckResult {
+	if portalDate.IsZero() {
+		return skipped("clock", "no Date header from the portal")
+	}
+
+	skew := time.Since(portalDate).Round(time.Second)
+	if skew > -maxClockSkew && skew < maxClockSkew {
+		return passed("clock", fmt.Sprintf("within %s of the portal", maxClockSkew))
+	}
+
+	direction := "ahead of"
+	if skew < 0 {
+		skew, direction = -skew, "behind"
+	}
+	detail := fmt.Sprintf("system clock is %s %s the portal", skew, direction)
+	if tlsResult.Status == CheckFail {
+		detail += ", which breaks certificate checks"
+	}
+	return failed("clock", detail, "Synchronise the clock, e.g. with 'timedatectl set-ntp true'.")
+}
+
+// passed, warned, failed and skipped build check results
+func passed(name, detail string) CheckResult {
+	return CheckResult{Name: name, Status: CheckPass, Detail: detail}
+}
+
+func warned(name, detail, hint string) CheckResult {
+	return CheckResult{Name: name, Status: CheckWarn, Detail: detail, Hint: hint}
+}
+
+func failed(name, detail, hint string) CheckResult {
+	return CheckResult{Name: name, Status: CheckFail, Detail: detail, Hint: hint}
+}
+
+func skipped(name, detail string) CheckResult {
+	return CheckResult{Name: name, Status: CheckSkip, Detail: detail}
+}
@@ -0,0 +1,121 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+)
+
+// Error categories reported by the client, check them with errors.Is
+var (
+	ErrNotOnCampus        = errors.New("not on campus network")
+	ErrPortalUnreachable  = errors.New("portal unreachable")
+	ErrBadCredentials     = errors.New("bad credentials")
+	ErrAccountLocked      = errors.New("account locked")
+	ErrCaptchaRequired    = errors.New("captcha required")
+	ErrCaptchaUnsolved    = errors.New("captcha solver failed")
+	ErrServiceUnavailable = errors.New("service unavailable")
+	ErrAlreadyOnline      = errors.New("already online elsewhere")
+	ErrUnexpectedSchema   = errors.New("unexpected response schema")
+)
+
+// PortalError reports a failed portal operation together with its category
+type PortalError struct {
+	Kind error  // One of the Err* categories, nil if unknown
+	Op   string // Operation that failed, e.g. "cas-sso login request failed"
+	Err  error  // Underlying cause
+}
+
+func (e *PortalError) Error() string {
+	return e.Op + ": " + e.Err.Error()
+}
+
+// Unwrap exposes both the category and the underlying cause to errors.Is/As
+func (e *PortalError) Unwrap() []error {
+	if e.Kind == nil {
+		return []error{e.Err}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// APIError is an eportal response whose code is not 200
+type APIError struct {
+	Code    int
+	Message string
+	Kind    error // Category derived from the message, nil if unknown
+}
+
+func (e *APIError) Error() string {
+	return "API error: " + e.Message
+}
+
+// Unwrap exposes the category to errors.Is
+func (e *APIError) Unwrap() error {
+	return e.Kind
+}
+
+// HTTPStatusError is a portal response with an HTTP error status
+type HTTPStatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *HTTPStatusError) Error() string {
+	return e.Status
+}
+
+// newPortalError wraps err with an operation and category
+func newPortalError(kind error, op string, err error) error {
+	return &PortalError{Kind: kind, Op: op, Err: err}
+}
+
+// requestError wraps a transport-level failure of an HTTP request
+func requestError(op string, err error) error {
+	return newPortalError(classifyTransportError(err), op, err)
+}
+
+// classifyTransportError maps network failures onto error categories
+func classifyTransportError(err error) error {
+	var dnsErr *net.DNSError
+	switch {
+	case errors.Is(err, context.Canceled):
+		// Cancelled by the caller, not a portal problem
+		return nil
+	case errors.As(err, &dnsErr):
+		// The auth host only resolves through the campus DNS
+		return ErrNotOnCampus
+	default:
+		return ErrPortalUnreachable
+	}
+}
+
+// classifyMessage maps a portal or CAS message onto an error category.
+// The portal only reports free-form (mostly Chinese) text, so this is the
+// single place where messages are matched.
+func classifyMessage(message string) error {
+	lower := strings.ToLower(message)
+	contains := func(keywords ...string) bool {
+		for _, keyword := range keywords {
+			if strings.Contains(lower, keyword) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch {
+	case contains("验证码", "captcha"):
+		return ErrCaptchaRequired
+	case contains("锁定", "冻结", "locked"):
+		return ErrAccountLocked
+	case contains("密码错误", "用户名或密码", "用户不存在", "账号不存在", "password", "credential"):
+		return ErrBadCredentials
+	case contains("已在线", "在线终端", "其他设备", "别处", "already online"):
+		return ErrAlreadyOnline
+	case contains("欠费", "余额", "未开通", "不可用", "停机", "unavailable"):
+		return ErrServiceUnavailable
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,296 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"ruijie-go/internal/logging"
+)
+
+// WithHAR writes every portal exchange to a HAR 1.2 file with secrets masked
+func WithHAR(path string) Option {
+	return func(r *RuijieClient) {
+		r.harFile = path
+	}
+}
+
+// HAR 1.2 document structure, see http://www.softwareishard.com/blog/har-12-spec/
+type (
+	harDocument struct {
+		Log harLog `json:"log"`
+	}
+	harLog struct {
+		Version string     `json:"version"`
+		Creator harCreator `json:"creator"`
+		Entries []harEntry `json:"entries"`
+	}
+	harCreator struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+	harEntry struct {
+		StartedDateTime string      `json:"startedDateTime"`
+		Time            float64     `json:"time"`
+		Request         harRequest  `json:"request"`
+		Response        harResponse `json:"response"`
+		Cache           struct{}    `json:"cache"`
+		Timings         harTimings  `json:"timings"`
+	}
+	harRequest struct {
+		Method      string         `json:"method"`
+		URL         string         `json:"url"`
+		HTTPVersion string         `json:"httpVersion"`
+		Cookies     []harNameValue `json:"cookies"`
+		Headers     []harNameValue `json:"headers"`
+		QueryString []harNameValue `json:"queryString"`
+		PostData    *harPostData   `json:"postData,omitempty"`
+		HeadersSize int            `json:"headersSize"`
+		BodySize    int            `json:"bodySize"`
+	}
+	harPostData struct {
+		MimeType string `json:"mimeType"`
+		Text     string `json:"text"`
+		Encoding string `json:"_encoding,omitempty"` // HAR has no encoding for post data
+	}
+	harResponse struct {
+		Status      int            `json:"status"`
+		StatusText  string         `json:"statusText"`
+		HTTPVersion string         `json:"httpVersion"`
+		Cookies     []harNameValue `json:"cookies"`
+		Headers     []harNameValue `json:"headers"`
+		Content     harContent     `json:"content"`
+		RedirectURL string         `json:"redirectURL"`
+		HeadersSize int            `json:"headersSize"`
+		BodySize    int            `json:"bodySize"`
+		Error       string         `json:"_error,omitempty"` // Transport error, the status is 0
+	}
+	harContent struct {
+		Size     int    `json:"size"`
+		MimeType string `json:"mimeType"`
+		Text     string `json:"text"`
+		Encoding string `json:"encoding,omitempty"`
+	}
+	harTimings struct {
+		Send    float64 `json:"send"`
+		Wait    float64 `json:"wait"`
+		Receive float64 `json:"receive"`
+	}
+	harNameValue struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+)
+
+// harClose closes the entries array and the document as indented by MarshalIndent
+const harClose = "]\n  }\n}"
+
+// harTrailer follows the last entry of the HAR file
+const harTrailer = "\n    " + harClose + "\n"
+
+// HARTransport logs every exchange passing through it to a HAR file. Each
+// exchange is written in place of the closing brackets, followed by them, so
+// the file is complete even if the run is aborted.
+type HARTransport struct {
+	Next http.RoundTripper
+	Path string
+
+	mu      sync.Mutex
+	entries int   // Entries written so far
+	end     int64 // Offset of the trailer
+}
+
+// NewHARTransport logs the exchanges of next to the HAR file at path
+func NewHARTransport(next http.RoundTripper, path string) (*HARTransport, error) {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, fmt.Errorf("failed to create HAR directory: %w", err)
+		}
+	}
+
+	// The empty document, cut open before the closing bracket of its entries
+	document, err := json.MarshalIndent(harDocument{Log: harLog{
+		Version: "1.2",
+		Creator: harCreator{Name: "ruijie-go", Version: buildVersion()},
+		Entries: []harEntry{},
+	}}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode HAR: %w", err)
+	}
+	header := strings.TrimSuffix(string(document), harClose)
+	if err := os.WriteFile(path, []byte(header+harTrailer), 0600); err != nil {
+		return nil, fmt.Errorf("failed to write HAR file: %w", err)
+	}
+
+	return &HARTransport{Next: next, Path: path, end: int64(len(header))}, nil
+}
+
+// RoundTrip performs the request and appends the exchange to the HAR file
+func (t *HARTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req, reqBody, err := copyRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	started := time.Now()
+	resp, err := t.Next.RoundTrip(req)
+	waited := time.Since(started)
+	if err != nil {
+		entry := newHAREntry(req, reqBody, started, waited)
+		entry.Response = harResponse{
+			Cookies:     []harNameValue{},
+			Headers:     []harNameValue{},
+			Content:     harContent{MimeType: "x-unknown"},
+			HeadersSize: -1,
+			BodySize:    -1,
+			Error:       logging.RedactString(err.Error()),
+		}
+		return nil, errors.Join(err, t.append(entry))
+	}
+	respBody, err := drainBody(&resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	received := time.Since(started) - waited
+
+	text, encoding := encodeBody(respBody, func(page string) string { return scrubPage(page, logging.Redacted) })
+	entry := newHAREntry(req, reqBody, started, waited)
+	if entry.Request.HTTPVersion == "" {
+		// Requests for followed redirects have no Proto, they used the protocol of the response
+		entry.Request.HTTPVersion = resp.Proto
+	}
+	entry.Time += milliseconds(received)
+	entry.Timings.Receive = milliseconds(received)
+	entry.Response = harResponse{
+		Status:      resp.StatusCode,
+		StatusText:  http.StatusText(resp.StatusCode),
+		HTTPVersion: resp.Proto,
+		Cookies:     []harNameValue{},
+		Headers:     harPairs(scrubHeader(resp.Header)),
+		Content: harContent{
+			Size:     len(respBody),
+			MimeType: resp.Header.Get("Content-Type"),
+			Text:     text,
+			Encoding: encoding,
+		},
+		RedirectURL: logging.RedactString(resp.Header.Get("Location")),
+		HeadersSize: -1,
+		BodySize:    len(respBody),
+	}
+	if err := t.append(entry); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// newHAREntry describes the request of an exchange, the caller adds the response
+func newHAREntry(req *http.Request, body []byte, started time.Time, waited time.Duration) harEntry {
+	maskedURL := logging.RedactString(req.URL.String())
+	entry := harEntry{
+		StartedDateTime: started.Format(time.RFC3339Nano),
+		Time:            milliseconds(waited),
+		Request: harRequest{
+			Method:      req.Method,
+			URL:         maskedURL,
+			HTTPVersion: req.Proto,
+			Cookies:     []harNameValue{},
+			Headers:     harPairs(scrubHeader(req.Header)),
+			QueryString: harQuery(maskedURL),
+			HeadersSize: -1,
+			BodySize:    len(body),
+		},
+		Timings: harTimings{Wait: milliseconds(waited)},
+	}
+	if body != nil {
+		text, encoding := encodeBody(body, logging.RedactString)
+		entry.Request.PostData = &harPostData{
+			MimeType: req.Header.Get("Content-Type"),
+			Text:     text,
+			Encoding: encoding,
+		}
+	}
+	return entry
+}
+
+// append writes entry over the trailer of the HAR file and the trailer after it
+func (t *HARTransport) append(entry harEntry) error {
+	data, err := json.MarshalIndent(entry, "      ", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode HAR: %w", err)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	separator := "\n      "
+	if t.entries > 0 {
+		separator = "," + separator
+	}
+	chunk := separator + string(data)
+
+	file, err := os.OpenFile(t.Path, os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write HAR file: %w", err)
+	}
+	if _, err := file.WriteAt([]byte(chunk+harTrailer), t.end); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write HAR file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write HAR file: %w", err)
+	}
+
+	t.entries++
+	t.end += int64(len(chunk))
+	return nil
+}
+
+// harQuery lists the query parameters of a URL
+func harQuery(rawURL string) []harNameValue {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return []harNameValue{}
+	}
+	return harPairs(parsed.Query())
+}
+
+// harPairs flattens a multi-valued map into name/value pairs sorted by name
+func harPairs(values map[string][]string) []harNameValue {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := []harNameValue{}
+	for _, name := range names {
+		for _, value := range values[name] {
+			pairs = append(pairs, harNameValue{Name: name, Value: value})
+		}
+	}
+	return pairs
+}
+
+// buildVersion returns the module version of the binary, "(devel)" for local builds
+func buildVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
+
+// milliseconds converts a duration into HAR milliseconds
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,163 @@
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ruijie-go/internal/client"
+)
+
+// harFile is the part of a HAR document the tests look at
+type harFile struct {
+	Log struct {
+		Entries []struct {
+			Request struct {
+				Method      string `json:"method"`
+				URL         string `json:"url"`
+				HTTPVersion string `json:"httpVersion"`
+				PostData    *struct {
+					Text string `json:"text"`
+				} `json:"postData"`
+			} `json:"request"`
+			Response struct {
+				Status      int    `json:"status"`
+				RedirectURL string `json:"redirectURL"`
+				Error       string `json:"_error"`
+				Content     struct {
+					Text     string `json:"text"`
+					Encoding string `json:"encoding"`
+				} `json:"content"`
+			} `json:"response"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+// readHAR parses the HAR file at path, which must be a complete document
+func readHAR(t *testing.T, path string) (harFile, string) {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var har harFile
+	if err := json.Unmarshal(data, &har); err != nil {
+		t.Fatalf("invalid HAR: %v\n%s", err, data)
+	}
+	return har, string(data)
+}
+
+func TestHARLogin(t *testing.T) {
+	portal := startPortal(t)
+	path := filepath.Join(t.TempDir(), "login.har")
+
+	if err := newClient(portal, client.WithHAR(path)).Login(context.Background(), "test", "hunter2", "校园网"); err == nil {
+		t.Fatal("Login with a wrong password succeeded")
+	}
+	if err := newClient(portal, client.WithHAR(path)).Login(context.Background(), "test", "test", "校园网"); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	har, raw := readHAR(t, path)
+
+	var redirects, forms, pages int
+	for i, entry := range har.Log.Entries {
+		request, response := entry.Request, entry.Response
+		if request.HTTPVersion != "HTTP/1.1" {
+			t.Errorf("%s has HTTP version %q", request.URL, request.HTTPVersion)
+		}
+		if response.Status == http.StatusFound {
+			redirects++
+			if response.RedirectURL == "" {
+				t.Errorf("redirect from %s has no redirectURL", request.URL)
+			} else if i+1 == len(har.Log.Entries) || !strings.HasSuffix(har.Log.Entries[i+1].Request.URL, response.RedirectURL) {
+				t.Errorf("redirect to %s is not followed by a request to it", response.RedirectURL)
+			}
+		}
+		if request.Method == http.MethodPost && strings.Contains(request.URL, "/cas-sso/login") {
+			forms++
+			if text := request.PostData.Text; !strings.Contains(text, "password=[REDACTED]") || !strings.Contains(text, "croypto=[REDACTED]") {
+				t.Errorf("login form is not masked: %s", text)
+			}
+		}
+		if strings.Contains(response.Content.Text, `id="login-croypto"`) {
+			pages++
+			if !strings.Contains(response.Content.Text, `id="login-croypto" style="display:none">[REDACTED]</p>`) {
+				t.Errorf("login page key is not masked: %s", response.Content.Text)
+			}
+		}
+	}
+
+	if redirects == 0 || forms == 0 || pages == 0 {
+		t.Errorf("HAR has %d redirects, %d login forms and %d login pages, want all of them", redirects, forms, pages)
+	}
+	if strings.Contains(raw, "hunter2") || strings.Contains(raw, "ticket=ST-") {
+		t.Errorf("HAR contains a password or ticket:\n%s", raw)
+	}
+}
+
+func TestHARFailedExchange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "failed.har")
+	transport, err := client.NewHARTransport(errTransport{}, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest(http.MethodPost, "http://portal.invalid/eportal/network/serviceLogin", strings.NewReader(`{"service":"校园网"}`))
+	if _, err := transport.RoundTrip(req); err == nil {
+		t.Fatal("RoundTrip succeeded through a failing transport")
+	}
+
+	har, _ := readHAR(t, path)
+	if len(har.Log.Entries) != 1 {
+		t.Fatalf("HAR has %d entries, want the failed exchange", len(har.Log.Entries))
+	}
+	if response := har.Log.Entries[0].Response; response.Status != 0 || response.Error != "connection reset by peer" {
+		t.Errorf("failed exchange logged with status %d and error %q", response.Status, response.Error)
+	}
+}
+
+func TestHARBinaryContent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write(jpegHeader)
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "captcha.har")
+	transport, err := client.NewHARTransport(http.DefaultTransport, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/cas-sso/login/captcha.jpg", nil)
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("RoundTrip: %v", err)
+		}
+		image, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if !bytes.Equal(image, jpegHeader) {
+			t.Errorf("caller received %x, want %x", image, jpegHeader)
+		}
+	}
+
+	har, _ := readHAR(t, path)
+	if len(har.Log.Entries) != 2 {
+		t.Fatalf("HAR has %d entries, want 2", len(har.Log.Entries))
+	}
+	for _, entry := range har.Log.Entries {
+		content := entry.Response.Content
+		image, err := base64.StdEncoding.DecodeString(content.Text)
+		if content.Encoding != "base64" || err != nil || !bytes.Equal(image, jpegHeader) {
+			t.Errorf("image logged as %q with encoding %q, want base64", content.Text, content.Encoding)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package client
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Default endpoints of the Yanshan University portal
+const (
+	DefaultPortalBaseURL = "https://auth1.ysu.edu.cn"
+	DefaultEportalPath   = "/eportal"
+	DefaultCasSSOPath    = "/cas-sso/login"
+)
+
+// Portal describes the endpoints of a Ruijie V2 portal deployment
+type Portal struct {
+	BaseURL     string // Scheme and host, e.g. https://auth1.ysu.edu.cn
+	EportalPath string // Prefix of the eportal API, e.g. /eportal
+	CasSSOPath  string // Path of the cas-sso login page, e.g. /cas-sso/login
+	RedirectURL string // URL probed to obtain the captive portal redirect
+}
+
+// DefaultPortal returns the portal profile of auth1.ysu.edu.cn
+func DefaultPortal() Portal {
+	return Portal{}.withDefaults()
+}
+
+// withDefaults fills empty fields with the defaults, deriving the redirect
+// probe URL from the base URL and eportal prefix
+func (p Portal) withDefaults() Portal {
+	if p.BaseURL == "" {
+		p.BaseURL = DefaultPortalBaseURL
+	}
+	p.BaseURL = strings.TrimRight(p.BaseURL, "/")
+
+	if p.EportalPath == "" {
+		p.EportalPath = DefaultEportalPath
+	}
+	p.EportalPath = "/" + strings.Trim(p.EportalPath, "/")
+
+	if p.CasSSOPath == "" {
+		p.CasSSOPath = DefaultCasSSOPath
+	}
+	p.CasSSOPath = "/" + strings.Trim(p.CasSSOPath, "/")
+
+	if p.RedirectURL == "" {
+		p.RedirectURL = p.EportalURL("/redirect.jsp") + "?mode=history"
+	}
+
+	return p
+}
+
+// EportalURL returns the absolute URL of an eportal API path, an eportal
+// prefix of "/" places the API at the root of the portal
+func (p Portal) EportalURL(path string) string {
+	return p.BaseURL + strings.TrimRight(p.EportalPath, "/") + "/" + strings.TrimLeft(path, "/")
+}
+
+// CasSSOURL returns the absolute URL of the cas-sso login page
+func (p Portal) CasSSOURL() string {
+	return p.BaseURL + p.CasSSOPath
+}
+
+// Address returns the host and port of the portal, the port defaults to the scheme's
+func (p Portal) Address() (host, port string, err error) {
+	parsed, err := url.Parse(p.BaseURL)
+	if err != nil {
+		return "", "", err
+	}
+	if parsed.Hostname() == "" {
+		return "", "", fmt.Errorf("portal URL %s has no host", p.BaseURL)
+	}
+
+	port = parsed.Port()
+	if port == "" {
+		port = "80"
+		if parsed.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return parsed.Hostname(), port, nil
+}
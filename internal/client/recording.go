@@ -0,0 +1,379 @@
+package client
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"ruijie-go/internal/logging"
+)
+
+// bodyBase64 marks a recorded body that is not text and saved base64 encoded
+const bodyBase64 = "base64"
+
+// replayKey replaces the AES key of recorded cas-sso pages, so replays can still encrypt
+const replayKey = "AAAAAAAAAAAAAAAAAAAAAA=="
+
+// secretHeaders are headers whose values are never recorded
+var secretHeaders = []string{"Cookie", "Set-Cookie", "Authorization", "Proxy-Authorization"}
+
+// Patterns of secrets inside recorded pages
+var (
+	croyptoElement   = regexp.MustCompile(`(<p[^>]*id="login-croypto"[^>]*>)[^<]*(</p>)`)
+	executionElement = regexp.MustCompile(`(<p[^>]*id="login-page-flowkey"[^>]*>)[^<]*(</p>)`)
+)
+
+// WithRecorder saves every portal exchange into dir with secrets scrubbed
+func WithRecorder(dir string) Option {
+	return func(r *RuijieClient) {
+		r.recordDir = dir
+	}
+}
+
+// WithReplay answers portal requests from the recordings in dir instead of the network
+func WithReplay(dir string) Option {
+	return func(r *RuijieClient) {
+		r.replayDir = dir
+	}
+}
+
+// wrapTransport applies replay, recording and HAR logging to the network transport. Setup
+// errors surface on the first request like any other transport error.
+func (r *RuijieClient) wrapTransport(transport http.RoundTripper) http.RoundTripper {
+	if r.replayDir != "" {
+		replay, err := NewReplayTransport(r.replayDir)
+		if err != nil {
+			return failingTransport{err}
+		}
+		transport = replay
+	}
+
+	if r.recordDir != "" {
+		recorder, err := NewRecordingTransport(transport, r.recordDir)
+		if err != nil {
+			return failingTransport{err}
+		}
+		transport = recorder
+	}
+
+	if r.harFile != "" {
+		har, err := NewHARTransport(transport, r.harFile)
+		if err != nil {
+			return failingTransport{err}
+		}
+		transport = har
+	}
+
+	return transport
+}
+
+// failingTransport fails every request with the same error
+type failingTransport struct {
+	err error
+}
+
+func (t failingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return nil, t.err
+}
+
+// Recording is one HTTP exchange saved by RecordingTransport. A failed
+// exchange has no response but the error the transport returned.
+type Recording struct {
+	Request  RecordedRequest   `json:"request"`
+	Response *RecordedResponse `json:"response,omitempty"`
+	Error    string            `json:"error,omitempty"`
+}
+
+// RecordedRequest is the scrubbed request of a recording
+type RecordedRequest struct {
+	Method       string      `json:"method"`
+	URL          string      `json:"url"`
+	Header       http.Header `json:"header"`
+	Body         string      `json:"body,omitempty"`
+	BodyEncoding string      `json:"bodyEncoding,omitempty"` // "base64" for binary bodies
+}
+
+// RecordedResponse is the scrubbed response of a recording
+type RecordedResponse struct {
+	StatusCode   int         `json:"statusCode"`
+	Header       http.Header `json:"header"`
+	Body         string      `json:"body,omitempty"`
+	BodyEncoding string      `json:"bodyEncoding,omitempty"` // "base64" for binary bodies such as captcha images
+}
+
+// RecordingTransport saves every exchange passing through it as a JSON file in Dir
+type RecordingTransport struct {
+	Next http.RoundTripper
+	Dir  string
+
+	mu  sync.Mutex
+	seq int
+}
+
+// NewRecordingTransport records the exchanges of next into dir, continuing
+// the numbering of recordings already present
+func NewRecordingTransport(next http.RoundTripper, dir string) (*RecordingTransport, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create recording directory: %w", err)
+	}
+	existing, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	return &RecordingTransport{Next: next, Dir: dir, seq: len(existing)}, nil
+}
+
+// RoundTrip performs the request and records the exchange, including
+// exchanges that fail without a response
+func (t *RecordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	out, reqBody, err := copyRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	recording := Recording{
+		Request: RecordedRequest{
+			Method: req.Method,
+			URL:    logging.RedactString(req.URL.String()),
+			Header: scrubHeader(req.Header),
+		},
+	}
+	recording.Request.Body, recording.Request.BodyEncoding = encodeBody(reqBody, logging.RedactString)
+
+	resp, err := t.Next.RoundTrip(out)
+	if err != nil {
+		recording.Error = logging.RedactString(err.Error())
+		if saveErr := t.save(req, &recording); saveErr != nil {
+			return nil, errors.Join(err, saveErr)
+		}
+		return nil, err
+	}
+	respBody, err := drainBody(&resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	recording.Response = &RecordedResponse{
+		StatusCode: resp.StatusCode,
+		Header:     scrubHeader(resp.Header),
+	}
+	recording.Response.Body, recording.Response.BodyEncoding = encodeBody(respBody, func(body string) string {
+		return scrubPage(body, replayKey)
+	})
+	// The scrubbed body no longer has the original length
+	recording.Response.Header.Del("Content-Length")
+
+	if err := t.save(req, &recording); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// save writes a recording as <seq>-<method>-<path>.json
+func (t *RecordingTransport) save(req *http.Request, recording *Recording) error {
+	// Keep recorded pages readable
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(recording); err != nil {
+		return fmt.Errorf("failed to encode recording: %w", err)
+	}
+
+	t.mu.Lock()
+	t.seq++
+	seq := t.seq
+	t.mu.Unlock()
+
+	name := strings.Trim(strings.NewReplacer("/", "_", ".", "_").Replace(req.URL.Path), "_")
+	file := filepath.Join(t.Dir, fmt.Sprintf("%04d-%s-%s.json", seq, req.Method, name))
+	if err := os.WriteFile(file, buf.Bytes(), 0600); err != nil {
+		return fmt.Errorf("failed to write recording: %w", err)
+	}
+
+	return nil
+}
+
+// ReplayTransport answers requests from recordings instead of the network.
+// Requests are matched by method and path in recorded order; once the
+// recordings of a path are used up, the last one is repeated.
+type ReplayTransport struct {
+	mu         sync.Mutex
+	recordings map[string][]*Recording
+}
+
+// NewReplayTransport loads the recordings saved in dir
+func NewReplayTransport(dir string) (*ReplayTransport, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no recordings found in %s", dir)
+	}
+	sort.Strings(files)
+
+	t := &ReplayTransport{recordings: make(map[string][]*Recording)}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read recording: %w", err)
+		}
+		var recording Recording
+		if err := json.Unmarshal(data, &recording); err != nil {
+			return nil, fmt.Errorf("failed to parse recording %s: %w", filepath.Base(file), err)
+		}
+
+		req, err := http.NewRequest(recording.Request.Method, recording.Request.URL, nil)
+		if err != nil {
+			return nil, fmt.Errorf("invalid request in recording %s: %w", filepath.Base(file), err)
+		}
+		key := replayMatchKey(req)
+		t.recordings[key] = append(t.recordings[key], &recording)
+	}
+
+	return t, nil
+}
+
+// RoundTrip answers the request with the next matching recording
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+
+	key := replayMatchKey(req)
+	t.mu.Lock()
+	queue := t.recordings[key]
+	var recording *Recording
+	if len(queue) > 0 {
+		recording = queue[0]
+		if len(queue) > 1 {
+			t.recordings[key] = queue[1:]
+		}
+	}
+	t.mu.Unlock()
+
+	if recording == nil {
+		return nil, fmt.Errorf("no recording for %s", key)
+	}
+	if recording.Response == nil {
+		// The recorded exchange failed, fail it the same way
+		return nil, errors.New(recording.Error)
+	}
+
+	body, err := decodeBody(recording.Response.Body, recording.Response.BodyEncoding)
+	if err != nil {
+		return nil, fmt.Errorf("invalid body in recording for %s: %w", key, err)
+	}
+	header := recording.Response.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recording.Response.StatusCode, http.StatusText(recording.Response.StatusCode)),
+		StatusCode:    recording.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// replayMatchKey identifies the recordings a request may be answered with
+func replayMatchKey(req *http.Request) string {
+	return req.Method + " " + req.URL.Path
+}
+
+// copyRequest reads the body of req and returns a copy of req carrying the
+// body again. RoundTrippers must not modify the caller's request.
+func copyRequest(req *http.Request) (*http.Request, []byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, nil, nil
+	}
+
+	data, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	out := req.Clone(req.Context())
+	out.Body = io.NopCloser(bytes.NewReader(data))
+	out.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	return out, data, nil
+}
+
+// encodeBody returns a body for saving, text passed through scrub and
+// anything else base64 encoded with its encoding name
+func encodeBody(data []byte, scrub func(string) string) (string, string) {
+	if utf8.Valid(data) {
+		return scrub(string(data)), ""
+	}
+	return base64.StdEncoding.EncodeToString(data), bodyBase64
+}
+
+// decodeBody reverses encodeBody
+func decodeBody(body, encoding string) ([]byte, error) {
+	switch encoding {
+	case "":
+		return []byte(body), nil
+	case bodyBase64:
+		return base64.StdEncoding.DecodeString(body)
+	default:
+		return nil, fmt.Errorf("unknown body encoding %q", encoding)
+	}
+}
+
+// drainBody reads a request or response body and replaces it with an in-memory copy
+func drainBody(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil || *body == http.NoBody {
+		return nil, nil
+	}
+
+	data, err := io.ReadAll(*body)
+	(*body).Close()
+	if err != nil {
+		return nil, err
+	}
+	*body = io.NopCloser(bytes.NewReader(data))
+
+	return data, nil
+}
+
+// scrubHeader copies a header with secret values and the parameters of redirects masked
+func scrubHeader(header http.Header) http.Header {
+	scrubbed := header.Clone()
+	for _, name := range secretHeaders {
+		if scrubbed.Get(name) != "" {
+			scrubbed.Set(name, logging.Redacted)
+		}
+	}
+	if location := scrubbed.Get("Location"); location != "" {
+		scrubbed.Set("Location", logging.RedactString(location))
+	}
+	return scrubbed
+}
+
+// scrubPage masks secret parameters and the flow key and replaces the cas-sso key with key
+func scrubPage(body, key string) string {
+	body = croyptoElement.ReplaceAllString(body, "${1}"+key+"${2}")
+	body = executionElement.ReplaceAllString(body, "${1}"+logging.Redacted+"${2}")
+	return logging.RedactString(body)
+}
@@ -0,0 +1,179 @@
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ruijie-go/internal/client"
+)
+
+// replayLogin logs in from the recordings in dir, no request reaches the network
+func replayLogin(t *testing.T, dir string) {
+	t.Helper()
+
+	ruijie := client.NewRuijieClient(nil, false,
+		client.WithPortal(client.Portal{BaseURL: "http://portal.invalid"}),
+		client.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		client.WithReplay(dir),
+	)
+	if err := ruijie.Login(context.Background(), "test", "test", "校园网"); err != nil {
+		t.Fatalf("Login from %s: %v", dir, err)
+	}
+}
+
+// TestReplayLogin replays a login recorded from the mock portal with
+// "ruijie-go --record testdata/login login -u test -p test -s 校园网". The
+// recorded cas-sso page carries the replay key instead of its own, which the
+// password must be encrypted with.
+func TestReplayLogin(t *testing.T) {
+	replayLogin(t, "testdata/login")
+}
+
+func TestRecordThenReplay(t *testing.T) {
+	portal := startPortal(t)
+	dir := t.TempDir()
+
+	if err := newClient(portal, client.WithRecorder(dir)).Login(context.Background(), "test", "test", "校园网"); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	portal.Close()
+
+	replayLogin(t, dir)
+}
+
+// jpegHeader is the start of a JPEG image, which is not valid UTF-8
+var jpegHeader = []byte{0xff, 0xd8, 0xff, 0xe0, 0x00, 0x10, 'J', 'F', 'I', 'F', 0x00}
+
+// errTransport fails every request
+type errTransport struct{}
+
+func (errTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.Body.Close()
+	return nil, errors.New("connection reset by peer")
+}
+
+// readRecordings returns the content of all recordings in dir
+func readRecordings(t *testing.T, dir string) string {
+	t.Helper()
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no recordings in %s: %v", dir, err)
+	}
+	var all strings.Builder
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		all.Write(data)
+	}
+	return all.String()
+}
+
+func TestRecordingKeepsCallerRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	recorder, err := client.NewRecordingTransport(http.DefaultTransport, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/cas-sso/login", strings.NewReader("username=test&password=hunter2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := req.Body
+
+	resp, err := recorder.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	echoed, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if req.Body != body {
+		t.Error("RoundTrip replaced the body of the caller's request")
+	}
+	if string(echoed) != "username=test&password=hunter2" {
+		t.Errorf("server received %q, want the form", echoed)
+	}
+	if recorded := readRecordings(t, dir); strings.Contains(recorded, "hunter2") {
+		t.Errorf("recording contains the password:\n%s", recorded)
+	}
+}
+
+func TestRecordAndReplayBinaryBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write(jpegHeader)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	recorder, err := client.NewRecordingTransport(http.DefaultTransport, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/cas-sso/login/captcha.jpg", nil)
+	resp, err := recorder.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	resp.Body.Close()
+	if recorded := readRecordings(t, dir); !strings.Contains(recorded, `"bodyEncoding": "base64"`) {
+		t.Errorf("binary body is not base64 encoded:\n%s", recorded)
+	}
+
+	replay, err := client.NewReplayTransport(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = replay.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	image, _ := io.ReadAll(resp.Body)
+	if !bytes.Equal(image, jpegHeader) {
+		t.Errorf("replayed image = %x, want %x", image, jpegHeader)
+	}
+}
+
+func TestRecordFailedExchange(t *testing.T) {
+	dir := t.TempDir()
+	recorder, err := client.NewRecordingTransport(errTransport{}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest(http.MethodPost, "http://portal.invalid/eportal/network/serviceLogin", strings.NewReader(`{"service":"校园网"}`))
+	if _, err := recorder.RoundTrip(req); err == nil {
+		t.Fatal("RoundTrip succeeded through a failing transport")
+	}
+
+	recorded := readRecordings(t, dir)
+	if !strings.Contains(recorded, `"error": "connection reset by peer"`) || !strings.Contains(recorded, "serviceLogin") {
+		t.Errorf("failed exchange is not recorded:\n%s", recorded)
+	}
+
+	replay, err := client.NewReplayTransport(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayReq, _ := http.NewRequest(http.MethodPost, "http://portal.invalid/eportal/network/serviceLogin", nil)
+	if _, err := replay.RoundTrip(replayReq); err == nil || !strings.Contains(err.Error(), "connection reset") {
+		t.Errorf("replay of a failed exchange = %v, want the recorded error", err)
+	}
+}
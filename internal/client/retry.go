@@ -0,0 +1,108 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"ruijie-go/internal/utils"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// RetryPolicy controls how transient failures of a single portal step are retried
+type RetryPolicy struct {
+	Attempts    int           // Attempts per step including the first, 1 disables retries
+	Backoff     time.Duration // Delay before the first retry, doubled for every further retry
+	MaxBackoff  time.Duration // Upper bound for a single delay
+	Jitter      float64       // Fraction of the delay that is randomised (0..1)
+	StatusCodes []int         // HTTP status codes treated as transient
+}
+
+// DefaultRetryPolicy retries connection failures and gateway errors twice
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		Attempts:    3,
+		Backoff:     500 * time.Millisecond,
+		MaxBackoff:  5 * time.Second,
+		Jitter:      0.2,
+		StatusCodes: []int{502, 503, 504},
+	}
+}
+
+// WithRetryPolicy sets the retry policy of the portal steps, zero fields keep the defaults
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(r *RuijieClient) {
+		defaults := DefaultRetryPolicy()
+		if policy.Attempts <= 0 {
+			policy.Attempts = defaults.Attempts
+		}
+		if policy.Backoff <= 0 {
+			policy.Backoff = defaults.Backoff
+		}
+		if policy.MaxBackoff <= 0 {
+			policy.MaxBackoff = defaults.MaxBackoff
+		}
+		if policy.Jitter <= 0 {
+			policy.Jitter = defaults.Jitter
+		}
+		if policy.StatusCodes == nil {
+			policy.StatusCodes = defaults.StatusCodes
+		}
+		r.retryPolicy = policy
+	}
+}
+
+// errLoginPageExpired marks a CAS login form whose execution/croypto pair is no longer accepted
+var errLoginPageExpired = errors.New("login page expired")
+
+// retryable reports whether err is a transient failure worth another attempt
+func (p RetryPolicy) retryable(err error) bool {
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) {
+		return slices.Contains(p.StatusCodes, statusErr.StatusCode)
+	}
+
+	// Connection resets and step timeouts, but not DNS failures off campus
+	return errors.Is(err, ErrPortalUnreachable)
+}
+
+// retry runs a portal step until it succeeds, fails permanently or runs out of attempts
+func (r *RuijieClient) retry(ctx context.Context, step string, fn func() error) error {
+	backoff := utils.Backoff{Base: r.retryPolicy.Backoff, Max: r.retryPolicy.MaxBackoff, Jitter: r.retryPolicy.Jitter}
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= r.retryPolicy.Attempts || ctx.Err() != nil || !r.retryPolicy.retryable(err) {
+			return err
+		}
+
+		delay := backoff.Next()
+		r.logger.Warn("Portal step failed, retrying", "step", step, "attempt", attempt, "max", r.retryPolicy.Attempts, "delay", delay, "error", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// serverError reports a 5xx answer to a page request, such pages never carry usable content
+func serverError(op string, resp *resty.Response) error {
+	if resp.StatusCode() < 500 {
+		return nil
+	}
+	return newPortalError(ErrPortalUnreachable, op, &HTTPStatusError{StatusCode: resp.StatusCode(), Status: resp.Status()})
+}
+
+// isExpiredMessage reports whether a CAS error message says the login form has expired
+func isExpiredMessage(message string) bool {
+	lower := strings.ToLower(message)
+	for _, keyword := range []string{"过期", "失效", "超时", "expired", "timeout"} {
+		if strings.Contains(lower, keyword) {
+			return true
+		}
+	}
+	return false
+}
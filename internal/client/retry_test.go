@@ -0,0 +1,147 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ruijie-go/internal/logging"
+)
+
+// fastRetries retries three times without noticeable delays
+var fastRetries = RetryPolicy{Attempts: 3, Backoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+// onlineUserInfo is a valid getOnlineUserInfo answer for a user who is offline
+const onlineUserInfo = `{"code":200,"message":"success","data":{"portalOnlineUserInfo":{"redirectUrl":"http://portal/redirect.jsp"}}}`
+
+// countingPortal answers getOnlineUserInfo with the given responses in turn,
+// repeating the last one, and counts the requests
+func countingPortal(t *testing.T, responses ...func(w http.ResponseWriter)) (*RuijieClient, *atomic.Int32) {
+	t.Helper()
+
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		n := int(calls.Add(1))
+		responses[min(n, len(responses))-1](w)
+	}))
+	t.Cleanup(server.Close)
+
+	r := NewRuijieClient(nil, false,
+		WithPortal(Portal{BaseURL: server.URL}),
+		WithLogger(logging.Discard()),
+		WithRetryPolicy(fastRetries),
+	)
+	return r, &calls
+}
+
+func status(code int) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		http.Error(w, http.StatusText(code), code)
+	}
+}
+
+func body(text string) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, text)
+	}
+}
+
+func TestRetryGatewayErrors(t *testing.T) {
+	for _, code := range []int{502, 503, 504} {
+		t.Run(fmt.Sprint(code), func(t *testing.T) {
+			r, calls := countingPortal(t, status(code), status(code), body(onlineUserInfo))
+
+			if _, err := r.GetOnlineUserInfo(context.Background(), ""); err != nil {
+				t.Fatalf("GetOnlineUserInfo: %v", err)
+			}
+			if n := calls.Load(); n != 3 {
+				t.Errorf("portal saw %d requests, want 3", n)
+			}
+		})
+	}
+}
+
+func TestNoRetryOnPermanentErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		response func(w http.ResponseWriter)
+		kind     error
+	}{
+		{"not found", status(404), ErrUnexpectedSchema},
+		{"internal server error", status(500), ErrPortalUnreachable},
+		{"portal rejection", body(`{"code":400,"message":"用户名或密码错误"}`), ErrBadCredentials},
+		{"malformed json", body(`{"code":200,"data":{`), ErrUnexpectedSchema},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, calls := countingPortal(t, tt.response, body(onlineUserInfo))
+
+			if _, err := r.GetOnlineUserInfo(context.Background(), ""); !errors.Is(err, tt.kind) {
+				t.Errorf("GetOnlineUserInfo error = %v, want %v", err, tt.kind)
+			}
+			if n := calls.Load(); n != 1 {
+				t.Errorf("portal saw %d requests, want 1", n)
+			}
+		})
+	}
+}
+
+func TestRetryGivesUpAfterMaxAttempts(t *testing.T) {
+	r, calls := countingPortal(t, status(502))
+
+	_, err := r.GetOnlineUserInfo(context.Background(), "")
+	var statusErr *HTTPStatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != 502 {
+		t.Errorf("GetOnlineUserInfo error = %v, want the last 502", err)
+	}
+	if n := calls.Load(); n != int32(fastRetries.Attempts) {
+		t.Errorf("portal saw %d requests, want %d", n, fastRetries.Attempts)
+	}
+}
+
+func TestRetryStopsWhenCancelled(t *testing.T) {
+	r := &RuijieClient{
+		logger:      logging.Discard(),
+		retryPolicy: RetryPolicy{Attempts: 5, Backoff: time.Hour, MaxBackoff: time.Hour},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	transient := newPortalError(ErrPortalUnreachable, "step failed", errors.New("connection reset"))
+	calls := 0
+	start := time.Now()
+	err := r.retry(ctx, "test step", func() error {
+		calls++
+		return transient
+	})
+
+	if !errors.Is(err, transient) {
+		t.Errorf("retry error = %v, want the step error", err)
+	}
+	if calls != 1 {
+		t.Errorf("step ran %d times, want 1", calls)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("retry returned after %v, want right after the cancel", elapsed)
+	}
+}
+
+func TestRetryableStatusCodes(t *testing.T) {
+	policy := DefaultRetryPolicy()
+	for code, want := range map[int]bool{502: true, 503: true, 504: true, 500: false, 404: false, 429: false} {
+		err := newPortalError(ErrPortalUnreachable, "HTTP error", &HTTPStatusError{StatusCode: code})
+		if got := policy.retryable(err); got != want {
+			t.Errorf("retryable(%d) = %v, want %v", code, got, want)
+		}
+	}
+	if policy.retryable(newPortalError(ErrNotOnCampus, "lookup failed", errors.New("no such host"))) {
+		t.Error("DNS failures off campus are retried")
+	}
+}
@@ -0,0 +1,40 @@
+package client
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"os"
+	"strings"
+)
+
+// defaultGateway reads the IPv4 default route from /proc/net/route
+func defaultGateway() (gateway net.IP, device string, err error) {
+	file, err := os.Open("/proc/net/route")
+	if err != nil {
+		return nil, "", err
+	}
+	defer file.Close()
+
+	// Columns: Iface Destination Gateway Flags ..., addresses in little-endian hex
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue
+		}
+		raw, err := hex.DecodeString(fields[2])
+		if err != nil || len(raw) != 4 {
+			continue
+		}
+		gateway = make(net.IP, 4)
+		binary.BigEndian.PutUint32(gateway, binary.LittleEndian.Uint32(raw))
+		return gateway, fields[0], nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, "", err
+	}
+
+	return nil, "", errNoDefaultRoute
+}
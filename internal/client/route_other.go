@@ -0,0 +1,10 @@
+//go:build !linux
+
+package client
+
+import "net"
+
+// defaultGateway is only implemented on Linux
+func defaultGateway() (gateway net.IP, device string, err error) {
+	return nil, "", errRouteUnsupported
+}
@@ -1,12 +1,17 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/url"
 	"strings"
 	"time"
 
+	"ruijie-go/internal/logging"
+	"ruijie-go/internal/models"
 	"ruijie-go/internal/utils"
 
 	"github.com/PuerkitoBio/goquery"
@@ -17,101 +22,254 @@ import (
 type RuijieClient struct {
 	client  *resty.Client
 	proxies map[string]string
-	verbose bool
+	portal  Portal
+	logger  *slog.Logger
+
+	stepTimeout   time.Duration
+	retryPolicy   RetryPolicy
+	captchaSolver CaptchaSolver
+	iface         string
+	sourceIP      string
+
+	sessionStore SessionStore
+	jar          *sessionJar
+	sessionInfo  map[string]string // Last known portal session, nil if none
+
+	serviceResolver ServiceResolver
+	serviceCache    ServiceCache
+
+	recordDir string // Directory recordings are saved to, empty disables recording
+	replayDir string // Directory recordings are replayed from, empty uses the network
+	harFile   string // HAR file all exchanges are logged to, empty disables it
 }
 
-// NewRuijieClient creates a new Ruijie client
-func NewRuijieClient(proxies map[string]string, verbose bool) *RuijieClient {
-	client := resty.New()
-	client.SetHeader("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/58.0.3029.110 Safari/537.3")
+// DefaultStepTimeout bounds a single portal step when no other timeout is set
+const DefaultStepTimeout = 15 * time.Second
+
+// Option customises a RuijieClient
+type Option func(*RuijieClient)
+
+// WithPortal sets the portal endpoints, empty fields fall back to the defaults
+func WithPortal(portal Portal) Option {
+	return func(r *RuijieClient) {
+		r.portal = portal.withDefaults()
+	}
+}
+
+// WithLogger sets the logger for debug and progress messages
+func WithLogger(logger *slog.Logger) Option {
+	return func(r *RuijieClient) {
+		r.logger = logger
+	}
+}
 
-	// Set proxy if provided
-	if len(proxies) > 0 {
-		if httpProxy, ok := proxies["http"]; ok {
-			client.SetProxy(httpProxy)
-		} else if httpsProxy, ok := proxies["https"]; ok {
-			client.SetProxy(httpsProxy)
+// WithStepTimeout sets the deadline of each portal step, zero keeps the default
+func WithStepTimeout(timeout time.Duration) Option {
+	return func(r *RuijieClient) {
+		if timeout > 0 {
+			r.stepTimeout = timeout
 		}
 	}
+}
 
-	return &RuijieClient{
-		client:  client,
+// NewRuijieClient creates a new Ruijie client. The proxies map holds the
+// "http" and "https" proxy URLs and an optional "no" exclusion list; an empty
+// map connects directly without consulting the environment.
+func NewRuijieClient(proxies map[string]string, verbose bool, opts ...Option) *RuijieClient {
+	r := &RuijieClient{
 		proxies: proxies,
-		verbose: verbose,
+		portal:  DefaultPortal(),
+
+		stepTimeout: DefaultStepTimeout,
+		retryPolicy: DefaultRetryPolicy(),
+	}
+	for _, opt := range opts {
+		opt(r)
 	}
+	if r.logger == nil {
+		r.logger = defaultLogger(verbose)
+	}
+
+	client := resty.New()
+	client.SetHeader("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/58.0.3029.110 Safari/537.3")
+	client.SetTransport(r.wrapTransport(r.newTransport()))
+	r.jar = newSessionJar()
+	client.SetCookieJar(r.jar)
+	client.SetTimeout(r.stepTimeout)
+	r.client = client
+
+	if r.sessionStore != nil {
+		r.restoreSession()
+	}
+
+	return r
 }
 
-// log outputs debug information if verbose mode is enabled
-func (r *RuijieClient) log(message string) {
-	if r.verbose {
-		fmt.Printf("[DEBUG] %s\n", message)
+// Portal returns the portal endpoints the client talks to
+func (r *RuijieClient) Portal() Portal {
+	return r.portal
+}
+
+// defaultLogger logs debug messages to stderr in verbose mode and nothing otherwise
+func defaultLogger(verbose bool) *slog.Logger {
+	if !verbose {
+		return logging.Discard()
 	}
+	logger, _, _ := logging.New(logging.Options{Level: "debug"})
+	return logger
+}
+
+// logSessionInfo logs the portal session parameters at debug level
+func (r *RuijieClient) logSessionInfo(sessionInfo map[string]string) {
+	r.logger.Debug("Got session info",
+		"sessionId", sessionInfo["sessionId"],
+		"nasIp", sessionInfo["nasIp"],
+		"userIp", sessionInfo["userIp"],
+		"ssid", sessionInfo["ssid"],
+		"customPageId", sessionInfo["customPageId"],
+	)
 }
 
-// unwrapResponse processes API responses and handles errors
-func (r *RuijieClient) unwrapResponse(resp *resty.Response, jsonResponse bool) (interface{}, error) {
+// stepContext derives the context of a single portal step
+func (r *RuijieClient) stepContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, r.stepTimeout)
+}
+
+// apiResponse is the common envelope of eportal JSON responses
+type apiResponse struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// decodeResponse checks the eportal envelope and decodes its data into out.
+// A nil out only checks the envelope, which suits calls without a payload.
+func (r *RuijieClient) decodeResponse(resp *resty.Response, out interface{}) error {
 	if resp.IsError() {
-		return nil, fmt.Errorf("HTTP error: %s", resp.Status())
+		kind := ErrUnexpectedSchema
+		if resp.StatusCode() >= 500 {
+			kind = ErrPortalUnreachable
+		}
+		return newPortalError(kind, "HTTP error", &HTTPStatusError{StatusCode: resp.StatusCode(), Status: resp.Status()})
 	}
 
-	if jsonResponse {
-		var data map[string]interface{}
-		if err := json.Unmarshal(resp.Body(), &data); err != nil {
-			return nil, fmt.Errorf("failed to parse JSON response: %w", err)
-		}
+	var envelope apiResponse
+	if err := json.Unmarshal(resp.Body(), &envelope); err != nil {
+		return newPortalError(ErrUnexpectedSchema, "failed to parse JSON response", err)
+	}
 
-		if code, ok := data["code"].(float64); ok && code == 200 {
-			return data["data"], nil
-		}
+	if envelope.Code != 200 {
+		return &APIError{Code: envelope.Code, Message: envelope.Message, Kind: classifyMessage(envelope.Message)}
+	}
 
-		message, _ := data["message"].(string)
-		return nil, fmt.Errorf("API error: %s", message)
+	if out == nil {
+		return nil
 	}
 
-	var result map[string]interface{}
-	if err := json.Unmarshal(resp.Body(), &result); err != nil {
-		return nil, fmt.Errorf("failed to parse JSON response: %w", err)
+	op := fmt.Sprintf("unexpected response schema from %s", resp.Request.URL)
+	if len(envelope.Data) == 0 || string(envelope.Data) == "null" {
+		return newPortalError(ErrUnexpectedSchema, op, errors.New("data is empty"))
+	}
+	if err := json.Unmarshal(envelope.Data, out); err != nil {
+		return newPortalError(ErrUnexpectedSchema, op, err)
 	}
 
-	return result, nil
+	return nil
 }
 
 // GetOnlineUserInfo gets current online user information
-func (r *RuijieClient) GetOnlineUserInfo(sessionID string) (map[string]interface{}, error) {
+func (r *RuijieClient) GetOnlineUserInfo(ctx context.Context, sessionID string) (*models.OnlineUserInfo, error) {
 	if sessionID == "" {
 		sessionID = "114514"
 	}
 
-	timestamp := time.Now().UnixMilli()
-	url := fmt.Sprintf("https://auth1.ysu.edu.cn/eportal/adaptor/getOnlineUserInfo?sessionId=%s&%d&version=this%%20is%%20a%%20git-commit", sessionID, timestamp)
+	var userInfo *models.OnlineUserInfo
+	err := r.retry(ctx, "get online user info", func() error {
+		ctx, cancel := r.stepContext(ctx)
+		defer cancel()
 
-	resp, err := r.client.R().Get(url)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get online user info: %w", err)
-	}
+		timestamp := time.Now().UnixMilli()
+		url := fmt.Sprintf("%s?sessionId=%s&%d&version=this%%20is%%20a%%20git-commit", r.portal.EportalURL("/adaptor/getOnlineUserInfo"), sessionID, timestamp)
+
+		resp, err := r.client.R().SetContext(ctx).Get(url)
+		if err != nil {
+			return requestError("failed to get online user info", err)
+		}
 
-	data, err := r.unwrapResponse(resp, true)
+		userInfo = &models.OnlineUserInfo{}
+		return r.decodeResponse(resp, userInfo)
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	return data.(map[string]interface{}), nil
+	return userInfo, nil
 }
 
 // RedirectToPortal redirects to portal and extracts session information
-func (r *RuijieClient) RedirectToPortal(redirectURL string) (map[string]string, error) {
+func (r *RuijieClient) RedirectToPortal(ctx context.Context, redirectURL string) (map[string]string, error) {
 	if redirectURL == "" {
-		redirectURL = "https://auth1.ysu.edu.cn/eportal/redirect.jsp?mode=history"
+		redirectURL = r.portal.RedirectURL
+	}
+
+	var finalURL string
+	err := r.retry(ctx, "redirect to portal", func() error {
+		var err error
+		finalURL, err = r.followPortalRedirect(ctx, redirectURL)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.Contains(finalURL, "portal-main") {
+		return nil, newPortalError(ErrNotOnCampus, "portal redirection failed", fmt.Errorf("expected URL to contain 'portal-main', but got: %s", finalURL))
+	}
+
+	params, err := parseSessionInfo(finalURL)
+	if err != nil {
+		return nil, err
+	}
+
+	r.sessionInfo = params
+	r.saveSession()
+
+	return params, nil
+}
+
+// parseSessionInfo extracts the session parameters from the portal-main URL
+func parseSessionInfo(portalURL string) (map[string]string, error) {
+	parsedURL, err := url.Parse(portalURL)
+	if err != nil {
+		return nil, newPortalError(ErrUnexpectedSchema, "failed to parse portal URL", err)
+	}
+
+	params := make(map[string]string)
+	for key, values := range parsedURL.Query() {
+		if len(values) > 0 {
+			params[key] = values[0]
+		}
 	}
+	return params, nil
+}
+
+// followPortalRedirect follows the HTTP and JavaScript redirects starting at
+// redirectURL and returns the URL finally reached
+func (r *RuijieClient) followPortalRedirect(ctx context.Context, redirectURL string) (string, error) {
+	ctx, cancel := r.stepContext(ctx)
+	defer cancel()
 
-	resp, err := r.client.R().Get(redirectURL)
+	resp, err := r.client.R().SetContext(ctx).Get(redirectURL)
 	if err != nil {
-		return nil, fmt.Errorf("failed to redirect to portal: %w", err)
+		return "", requestError("failed to redirect to portal", err)
+	}
+	if err := serverError("failed to redirect to portal", resp); err != nil {
+		return "", err
 	}
 
 	// Get final URL after redirects
 	finalURL := resp.RawResponse.Request.URL.String()
-	r.log(fmt.Sprintf("Portal redirect final URL: %s", finalURL))
+	r.logger.Debug("Portal redirect finished", "url", finalURL)
 
 	// Handle JavaScript redirect (e.g. top.self.location.href='...')
 	if strings.Contains(resp.String(), "location.href=") {
@@ -122,74 +280,85 @@ func (r *RuijieClient) RedirectToPortal(redirectURL string) (map[string]string,
 			end := strings.Index(content[start:], "'")
 			if end > 0 {
 				redirectURL2 := content[start : start+end]
-				r.log(fmt.Sprintf("Following JS redirect to: %s", redirectURL2))
-				resp, err = r.client.R().Get(redirectURL2)
+				r.logger.Debug("Following JS redirect", "url", redirectURL2)
+				resp, err = r.client.R().SetContext(ctx).Get(redirectURL2)
 				if err != nil {
-					return nil, fmt.Errorf("failed to follow JavaScript redirect: %w", err)
+					return "", requestError("failed to follow JavaScript redirect", err)
+				}
+				if err := serverError("failed to follow JavaScript redirect", resp); err != nil {
+					return "", err
 				}
 				finalURL = resp.RawResponse.Request.URL.String()
-				r.log(fmt.Sprintf("JS redirect final URL: %s", finalURL))
+				r.logger.Debug("JS redirect finished", "url", finalURL)
 			}
 		}
 	}
 
-	if !strings.Contains(finalURL, "portal-main") {
-		return nil, fmt.Errorf("portal redirection failed. Expected URL to contain 'portal-main', but got: %s", finalURL)
-	}
-
-	// Parse URL parameters
-	parsedURL, err := url.Parse(finalURL)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse portal URL: %w", err)
-	}
-
-	params := make(map[string]string)
-	for key, values := range parsedURL.Query() {
-		if len(values) > 0 {
-			params[key] = values[0]
-		}
-	}
-
-	return params, nil
+	return finalURL, nil
 }
 
 // getCurrentNode gets current workflow node
-func (r *RuijieClient) getCurrentNode(sessionInfo map[string]string, flowKey string) (map[string]interface{}, error) {
+func (r *RuijieClient) getCurrentNode(ctx context.Context, sessionInfo map[string]string, flowKey string) (*models.CurrentNode, error) {
 	if flowKey == "" {
 		flowKey = "portal_auth"
 	}
 
-	nodeURL := "https://auth1.ysu.edu.cn/eportal/workFlow/getCurrentNode"
+	nodeURL := r.portal.EportalURL("/workFlow/getCurrentNode")
 	requestData := map[string]interface{}{
 		"sessionId": sessionInfo["sessionId"],
 		"flowKey":   flowKey,
 	}
 
-	resp, err := r.client.R().
-		SetHeader("Content-Type", "application/json").
-		SetBody(requestData).
-		Post(nodeURL)
+	var node *models.CurrentNode
+	err := r.retry(ctx, "get current node", func() error {
+		ctx, cancel := r.stepContext(ctx)
+		defer cancel()
 
-	if err != nil {
-		return nil, fmt.Errorf("failed to get current node: %w", err)
-	}
+		resp, err := r.client.R().SetContext(ctx).
+			SetHeader("Content-Type", "application/json").
+			SetBody(requestData).
+			Post(nodeURL)
 
-	var nodeResp map[string]interface{}
-	if err := json.Unmarshal(resp.Body(), &nodeResp); err != nil {
-		return nil, fmt.Errorf("failed to parse node response: %w", err)
-	}
+		if err != nil {
+			return requestError("failed to get current node", err)
+		}
 
-	if data, ok := nodeResp["data"].(map[string]interface{}); ok {
-		if currentNode, ok := data["currentNodePath"].(string); ok {
-			r.log(fmt.Sprintf("Current Node: %s", currentNode))
+		node = &models.CurrentNode{}
+		if err := r.decodeResponse(resp, node); err != nil {
+			return fmt.Errorf("failed to parse node response: %w", err)
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	r.logger.Debug("Current workflow node", "node", node.CurrentNodePath)
 
-	return nodeResp, nil
+	return node, nil
 }
 
 // CasSSOLogin performs direct CAS-SSO authentication (new method replacing CAS+SAM)
-func (r *RuijieClient) CasSSOLogin(username, password string, sessionInfo map[string]string) error {
+func (r *RuijieClient) CasSSOLogin(ctx context.Context, username, password string, sessionInfo map[string]string) error {
+	casSSOURL := r.casSSOLoginURL(sessionInfo)
+
+	// After repeated failures the page starts asking for a captcha. Every attempt
+	// fetches a fresh page so croypto, execution and the captcha stay in sync.
+	// The form is only posted again when the portal rejected the captcha or the
+	// expired form outright, never after a transient failure, as every post may
+	// count as a failed login towards the captcha and lockout limits. A solver
+	// that fails reports ErrCaptchaUnsolved and is not asked again.
+	for attempt := 1; ; attempt++ {
+		err := r.casSSOAttempt(ctx, username, password, casSSOURL)
+		captchaRejected := errors.Is(err, ErrCaptchaRequired) && r.captchaSolver != nil
+		if !captchaRejected && !errors.Is(err, errLoginPageExpired) || attempt >= maxCaptchaAttempts {
+			return err
+		}
+		r.logger.Info("Login form rejected, retrying with a fresh page", "attempt", attempt, "max", maxCaptchaAttempts, "error", err)
+	}
+}
+
+// casSSOLoginURL returns the cas-sso login page URL of a portal session
+func (r *RuijieClient) casSSOLoginURL(sessionInfo map[string]string) string {
 	sessionID := sessionInfo["sessionId"]
 	customPageID := sessionInfo["customPageId"]
 	nasIP := sessionInfo["nasIp"]
@@ -198,374 +367,550 @@ func (r *RuijieClient) CasSSOLogin(username, password string, sessionInfo map[st
 	mode := sessionInfo["mode"]
 
 	timer := fmt.Sprintf("%d", time.Now().UnixMilli())
-	casSSOURL := fmt.Sprintf(
-		"https://auth1.ysu.edu.cn/cas-sso/login?flowSessionId=%s&customPageId=%s&preview=false&appType=normal&language=zh-CN&mode=%s&timer=%s&nasIp=%s&userIp=%s&ssid=%s",
-		sessionID, customPageID, mode, timer, nasIP, userIP, ssid,
+	return fmt.Sprintf(
+		"%s?flowSessionId=%s&customPageId=%s&preview=false&appType=normal&language=zh-CN&mode=%s&timer=%s&nasIp=%s&userIp=%s&ssid=%s",
+		r.portal.CasSSOURL(), sessionID, customPageID, mode, timer, nasIP, userIP, ssid,
 	)
+}
 
+// casSSOAttempt fetches the cas-sso login page and submits the login form once.
+// Only the page fetch is retried on transient failures.
+func (r *RuijieClient) casSSOAttempt(ctx context.Context, username, password, casSSOURL string) error {
 	// Step 1: GET cas-sso/login page to extract croypto and execution
-	r.log("Fetching cas-sso login page...")
-	resp, err := r.client.R().Get(casSSOURL)
+	r.logger.Debug("Fetching cas-sso login page")
+	var resp *resty.Response
+	err := r.retry(ctx, "fetch cas-sso page", func() error {
+		stepCtx, cancel := r.stepContext(ctx)
+		defer cancel()
+
+		var err error
+		resp, err = r.client.R().SetContext(stepCtx).Get(casSSOURL)
+		if err != nil {
+			return requestError("failed to fetch cas-sso page", err)
+		}
+		return serverError("failed to fetch cas-sso page", resp)
+	})
 	if err != nil {
-		return fmt.Errorf("failed to fetch cas-sso page: %w", err)
+		return err
+	}
+
+	// A CAS ticket cookie restored from an earlier run skips the login form
+	if pageURL := resp.RawResponse.Request.URL.String(); strings.Contains(pageURL, "auth-success") || strings.Contains(pageURL, "ticket=") {
+		r.logger.Debug("CAS-SSO session still valid, got ticket without login")
+		return nil
 	}
 
 	doc, err := goquery.NewDocumentFromReader(strings.NewReader(resp.String()))
 	if err != nil {
-		return fmt.Errorf("failed to parse cas-sso page: %w", err)
+		return newPortalError(ErrUnexpectedSchema, "failed to parse cas-sso page", err)
 	}
 
 	croypto := strings.TrimSpace(doc.Find("p#login-croypto").Text())
 	execution := strings.TrimSpace(doc.Find("p#login-page-flowkey").Text())
 	if croypto == "" || execution == "" {
-		return fmt.Errorf("failed to extract croypto/execution from cas-sso page")
+		return newPortalError(ErrUnexpectedSchema, "failed to parse cas-sso page", errors.New("croypto/execution not found"))
 	}
-	r.log(fmt.Sprintf("Got croypto: %s..., execution length: %d", croypto[:20], len(execution)))
+	r.logger.Debug("Parsed cas-sso login page", "croypto", croypto, "execution", execution)
 
-	// Step 2: Encrypt password with AES-ECB
+	// Step 2: Solve the captcha if the page shows one
+	captchaCode := ""
+	if captchaURL := findCaptchaImage(doc, resp.RawResponse.Request.URL); captchaURL != "" {
+		captchaCode, err = r.solveCaptcha(ctx, captchaURL)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Step 3: Encrypt password and captcha payload with AES-ECB
 	encryptedPassword, err := utils.AESEncryptECB(croypto, password)
 	if err != nil {
-		return fmt.Errorf("failed to encrypt password: %w", err)
+		return newPortalError(ErrUnexpectedSchema, "failed to encrypt password", err)
 	}
-	encryptedCaptcha, err := utils.AESEncryptECB(croypto, "{}")
+	encryptedCaptcha, err := utils.AESEncryptECB(croypto, captchaPayload(captchaCode))
 	if err != nil {
 		return fmt.Errorf("failed to encrypt captcha payload: %w", err)
 	}
 
-	// Step 3: POST login form
+	// Step 4: POST login form
 	postURL := casSSOURL + "&accept-language=zh-CN"
-	r.log("Submitting cas-sso login form...")
-	resp, err = r.client.R().
+	r.logger.Debug("Submitting cas-sso login form", "username", username)
+	stepCtx, cancel := r.stepContext(ctx)
+	defer cancel()
+	resp, err = r.client.R().SetContext(stepCtx).
 		SetFormData(map[string]string{
 			"username":        username,
 			"type":            "UsernamePassword",
 			"_eventId":        "submit",
 			"geolocation":     "",
 			"execution":       execution,
-			"captcha_code":    "",
+			"captcha_code":    captchaCode,
 			"croypto":         croypto,
 			"password":        encryptedPassword,
 			"captcha_payload": encryptedCaptcha,
 		}).
 		Post(postURL)
 	if err != nil {
-		return fmt.Errorf("cas-sso login request failed: %w", err)
+		return requestError("cas-sso login request failed", err)
+	}
+	if err := serverError("cas-sso login request failed", resp); err != nil {
+		return err
 	}
 
 	finalURL := resp.RawResponse.Request.URL.String()
-	r.log(fmt.Sprintf("Login response URL: %s", finalURL))
+	r.logger.Debug("Login form submitted", "url", finalURL)
 	if strings.Contains(finalURL, "auth-success") || strings.Contains(finalURL, "ticket=") {
-		r.log("CAS-SSO login succeeded (got ticket)")
+		r.logger.Debug("CAS-SSO login succeeded")
 		return nil
 	}
 
 	// Check for error message in response
 	errorDoc, err := goquery.NewDocumentFromReader(strings.NewReader(resp.String()))
 	if err == nil {
-		if errorMsg := strings.TrimSpace(errorDoc.Find("#errorMessage").Text()); errorMsg != "" {
-			return fmt.Errorf("login failed: %s", errorMsg)
+		errorMsg := strings.TrimSpace(errorDoc.Find("#errorMessage").Text())
+		kind := classifyMessage(errorMsg)
+		switch {
+		case errorMsg != "" && kind == nil && isExpiredMessage(errorMsg):
+			return newPortalError(ErrUnexpectedSchema, "login failed", fmt.Errorf("%w: %s", errLoginPageExpired, errorMsg))
+		case errorMsg != "":
+			// An unrecognised rejection of the login form is most likely a credential problem
+			if kind == nil {
+				kind = ErrBadCredentials
+			}
+			return newPortalError(kind, "login failed", errors.New(errorMsg))
 		}
 	}
 
-	return fmt.Errorf("CAS-SSO login failed, final URL: %s", finalURL)
+	return newPortalError(ErrUnexpectedSchema, "CAS-SSO login failed", fmt.Errorf("final URL: %s", finalURL))
+}
+
+// solveCaptcha downloads a captcha image and passes it to the configured solver
+func (r *RuijieClient) solveCaptcha(ctx context.Context, captchaURL string) (string, error) {
+	if r.captchaSolver == nil {
+		return "", newPortalError(ErrCaptchaRequired, "cas-sso login", errors.New("the login page requires a captcha but no solver is configured"))
+	}
+
+	r.logger.Debug("Downloading captcha", "url", captchaURL)
+	stepCtx, cancel := r.stepContext(ctx)
+	resp, err := r.client.R().SetContext(stepCtx).Get(captchaURL)
+	cancel()
+	if err != nil {
+		return "", requestError("failed to download captcha", err)
+	}
+	if resp.IsError() {
+		return "", newPortalError(ErrUnexpectedSchema, "failed to download captcha", errors.New(resp.Status()))
+	}
+
+	// Solving may wait for a human, so it is only bound by the caller's context
+	code, err := r.captchaSolver.SolveCaptcha(ctx, resp.Body())
+	if err != nil {
+		return "", newPortalError(ErrCaptchaUnsolved, "failed to solve captcha", err)
+	}
+
+	return strings.TrimSpace(code), nil
 }
 
 // ServiceSelection gets available services
-func (r *RuijieClient) ServiceSelection(sessionInfo map[string]string) (interface{}, error) {
-	serviceURL := "https://auth1.ysu.edu.cn/eportal/network/serviceSelection"
+func (r *RuijieClient) ServiceSelection(ctx context.Context, sessionInfo map[string]string) (*models.ServiceList, error) {
+	serviceURL := r.portal.EportalURL("/network/serviceSelection")
 	requestData := map[string]interface{}{
 		"sessionId": sessionInfo["sessionId"],
 	}
 
-	resp, err := r.client.R().
-		SetHeader("Content-Type", "application/json").
-		SetBody(requestData).
-		Post(serviceURL)
+	var services *models.ServiceList
+	err := r.retry(ctx, "service selection", func() error {
+		ctx, cancel := r.stepContext(ctx)
+		defer cancel()
 
-	if err != nil {
-		return nil, fmt.Errorf("service selection failed: %w", err)
-	}
+		resp, err := r.client.R().SetContext(ctx).
+			SetHeader("Content-Type", "application/json").
+			SetBody(requestData).
+			Post(serviceURL)
 
-	r.getCurrentNode(sessionInfo, "portal_auth")
+		if err != nil {
+			return requestError("service selection failed", err)
+		}
 
-	data, err := r.unwrapResponse(resp, true)
+		services = &models.ServiceList{}
+		return r.decodeResponse(resp, services)
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	return data, nil
+	r.cacheServices(services)
+
+	return services, nil
 }
 
-// ServiceLogin logs into specified service
-func (r *RuijieClient) ServiceLogin(sessionInfo map[string]string, service string) (map[string]interface{}, error) {
-	serviceURL := "https://auth1.ysu.edu.cn/eportal/network/serviceLogin"
+// ServiceLogin logs into specified service. The login is not idempotent, so a
+// retry first checks whether the previous attempt went through after all.
+func (r *RuijieClient) ServiceLogin(ctx context.Context, sessionInfo map[string]string, service string) (*models.ServiceLoginResult, error) {
+	serviceURL := r.portal.EportalURL("/network/serviceLogin")
 	requestData := map[string]interface{}{
 		"sessionId": sessionInfo["sessionId"],
 		"service":   service,
 	}
 
-	resp, err := r.client.R().
-		SetHeader("Content-Type", "application/json").
-		SetBody(requestData).
-		Post(serviceURL)
+	var result *models.ServiceLoginResult
+	attempt := 0
+	err := r.retry(ctx, "service login", func() error {
+		attempt++
+		if attempt > 1 {
+			if status, err := r.probeUserOnline(ctx, sessionInfo); err == nil && status.Online {
+				r.logger.Debug("Previous service login attempt succeeded")
+				result = &models.ServiceLoginResult{AuthResult: "success"}
+				return nil
+			}
+		}
 
-	if err != nil {
-		return nil, fmt.Errorf("service login failed: %w", err)
-	}
+		ctx, cancel := r.stepContext(ctx)
+		defer cancel()
 
-	r.getCurrentNode(sessionInfo, "portal_auth")
+		resp, err := r.client.R().SetContext(ctx).
+			SetHeader("Content-Type", "application/json").
+			SetBody(requestData).
+			Post(serviceURL)
 
-	var result map[string]interface{}
-	if err := json.Unmarshal(resp.Body(), &result); err != nil {
-		return nil, fmt.Errorf("failed to parse service login response: %w", err)
+		if err != nil {
+			return requestError("service login failed", err)
+		}
+
+		result = &models.ServiceLoginResult{}
+		if err := r.decodeResponse(resp, result); err != nil {
+			return fmt.Errorf("invalid service login response: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return result, nil
 }
 
 // UserOnline checks if user is online
-func (r *RuijieClient) UserOnline(sessionInfo map[string]string) (map[string]interface{}, error) {
-	onlineURL := "https://auth1.ysu.edu.cn/eportal/network/userOnline"
+func (r *RuijieClient) UserOnline(ctx context.Context, sessionInfo map[string]string) (*models.OnlineStatus, error) {
+	var status *models.OnlineStatus
+	err := r.retry(ctx, "user online check", func() error {
+		var err error
+		status, err = r.probeUserOnline(ctx, sessionInfo)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return status, nil
+}
+
+// probeUserOnline checks once if user is online, for use inside the retry loop of another step
+func (r *RuijieClient) probeUserOnline(ctx context.Context, sessionInfo map[string]string) (*models.OnlineStatus, error) {
 	requestData := map[string]interface{}{
 		"sessionId": sessionInfo["sessionId"],
 	}
 
-	resp, err := r.client.R().
+	ctx, cancel := r.stepContext(ctx)
+	defer cancel()
+
+	resp, err := r.client.R().SetContext(ctx).
 		SetHeader("Content-Type", "application/json").
 		SetBody(requestData).
-		Post(onlineURL)
+		Post(r.portal.EportalURL("/network/userOnline"))
 
 	if err != nil {
-		return nil, fmt.Errorf("user online check failed: %w", err)
+		return nil, requestError("user online check failed", err)
 	}
 
-	data, err := r.unwrapResponse(resp, true)
-	if err != nil {
+	status := &models.OnlineStatus{}
+	if err := r.decodeResponse(resp, status); err != nil {
 		return nil, err
 	}
-
-	return data.(map[string]interface{}), nil
+	return status, nil
 }
 
 // GetAccountInfo gets account information
-func (r *RuijieClient) GetAccountInfo(sessionInfo map[string]string) (map[string]interface{}, error) {
-	accountURL := "https://auth1.ysu.edu.cn/eportal/operator/getAccountInfo"
+func (r *RuijieClient) GetAccountInfo(ctx context.Context, sessionInfo map[string]string) (*models.AccountInfo, error) {
+	accountURL := r.portal.EportalURL("/operator/getAccountInfo")
 	requestData := map[string]interface{}{
 		"sessionId": sessionInfo["sessionId"],
 	}
 
-	resp, err := r.client.R().
-		SetHeader("Content-Type", "application/json").
-		SetBody(requestData).
-		Post(accountURL)
+	var accountInfo *models.AccountInfo
+	err := r.retry(ctx, "get account info", func() error {
+		ctx, cancel := r.stepContext(ctx)
+		defer cancel()
 
-	if err != nil {
-		return nil, fmt.Errorf("get account info failed: %w", err)
-	}
+		resp, err := r.client.R().SetContext(ctx).
+			SetHeader("Content-Type", "application/json").
+			SetBody(requestData).
+			Post(accountURL)
+
+		if err != nil {
+			return requestError("get account info failed", err)
+		}
 
-	data, err := r.unwrapResponse(resp, true)
+		accountInfo = &models.AccountInfo{}
+		return r.decodeResponse(resp, accountInfo)
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	return data.(map[string]interface{}), nil
+	return accountInfo, nil
 }
 
-// Offline logs user out
-func (r *RuijieClient) Offline(sessionInfo map[string]string) (map[string]interface{}, error) {
-	offlineURL := "https://auth1.ysu.edu.cn/eportal/network/offline"
+// Offline logs user out. Like ServiceLogin, a retry first checks whether the
+// previous attempt went through after all.
+func (r *RuijieClient) Offline(ctx context.Context, sessionInfo map[string]string) error {
+	offlineURL := r.portal.EportalURL("/network/offline")
 	requestData := map[string]interface{}{
 		"sessionId": sessionInfo["sessionId"],
 	}
 
-	resp, err := r.client.R().
-		SetHeader("Content-Type", "application/json").
-		SetBody(requestData).
-		Post(offlineURL)
+	attempt := 0
+	return r.retry(ctx, "offline", func() error {
+		attempt++
+		if attempt > 1 {
+			if status, err := r.probeUserOnline(ctx, sessionInfo); err == nil && !status.Online {
+				r.logger.Debug("Previous offline attempt succeeded")
+				return nil
+			}
+		}
 
-	if err != nil {
-		return nil, fmt.Errorf("offline failed: %w", err)
-	}
+		ctx, cancel := r.stepContext(ctx)
+		defer cancel()
 
-	data, err := r.unwrapResponse(resp, true)
-	if err != nil {
-		return nil, err
-	}
+		resp, err := r.client.R().SetContext(ctx).
+			SetHeader("Content-Type", "application/json").
+			SetBody(requestData).
+			Post(offlineURL)
 
-	if data == nil {
-		return nil, nil
-	}
-	return data.(map[string]interface{}), nil
+		if err != nil {
+			return requestError("offline failed", err)
+		}
+
+		return r.decodeResponse(resp, nil)
+	})
 }
 
 // CheckLoginStatus checks current login status
-func (r *RuijieClient) CheckLoginStatus() (bool, interface{}, error) {
-	userInfo, err := r.GetOnlineUserInfo("")
+func (r *RuijieClient) CheckLoginStatus(ctx context.Context) (bool, *models.OnlineUserInfo, error) {
+	sessionID := r.sessionInfo["sessionId"]
+	userInfo, err := r.GetOnlineUserInfo(ctx, sessionID)
+	if err != nil && sessionID != "" && isStaleSession(err) {
+		r.logger.Debug("Saved session rejected, checking status without it", "error", err)
+		r.sessionInfo = nil
+		userInfo, err = r.GetOnlineUserInfo(ctx, "")
+	}
 	if err != nil {
-		r.log(fmt.Sprintf("Error checking login status: %v", err))
+		r.logger.Debug("Failed to check login status", "error", err)
 		return false, nil, err
 	}
 
-	if portalInfo, ok := userInfo["portalOnlineUserInfo"].(map[string]interface{}); ok {
-		if redirectURL, exists := portalInfo["redirectUrl"]; exists && redirectURL != nil {
-			// Not logged in
-			return false, redirectURL, nil
-		}
-	}
-
-	// Logged in
-	return true, userInfo, nil
+	return userInfo.IsOnline(), userInfo, nil
 }
 
-// GetAvailableServices gets available services without logging in
-func (r *RuijieClient) GetAvailableServices(username, password string) (interface{}, error) {
+// GetAvailableServices gets available services without logging in. While
+// offline they are only shown after a CAS login, credentials is called then
+// for the username and password and not at all while online.
+func (r *RuijieClient) GetAvailableServices(ctx context.Context, credentials func() (string, string, error)) (*models.ServiceList, error) {
 	// Check current status
-	isLoggedIn, _, err := r.CheckLoginStatus()
+	isLoggedIn, _, err := r.CheckLoginStatus(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	if isLoggedIn {
-		// If already logged in, get session info and query services
-		sessionInfo, err := r.RedirectToPortal("")
-		if err != nil {
-			return nil, err
-		}
-		return r.ServiceSelection(sessionInfo)
+		// If already logged in, query services with the current session
+		var services *models.ServiceList
+		err := r.withSession(ctx, func(sessionInfo map[string]string) error {
+			var err error
+			services, err = r.ServiceSelection(ctx, sessionInfo)
+			return err
+		})
+		return services, err
 	}
 
 	// Redirect to portal to get session info
-	sessionInfo, err := r.RedirectToPortal("")
+	sessionInfo, err := r.RedirectToPortal(ctx, "")
 	if err != nil {
 		return nil, err
 	}
-	r.log(fmt.Sprintf("Got session info: %v", sessionInfo))
+	r.logSessionInfo(sessionInfo)
 
 	// CAS-SSO login
-	if err := r.CasSSOLogin(username, password, sessionInfo); err != nil {
+	username, password, err := credentials()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.CasSSOLogin(ctx, username, password, sessionInfo); err != nil {
 		return nil, fmt.Errorf("CAS-SSO authentication failed: %w", err)
 	}
+	// Keep the CAS ticket cookie so a later login skips the form
+	r.saveSession()
 
 	// Get services
-	services, err := r.ServiceSelection(sessionInfo)
+	services, err := r.ServiceSelection(ctx, sessionInfo)
 	if err != nil {
 		return nil, err
 	}
-	r.log(fmt.Sprintf("Available services: %v", services))
+	r.logger.Debug("Fetched available services", "services", services.Names())
 
 	return services, nil
 }
 
 // Login performs complete login flow
-func (r *RuijieClient) Login(username, password, service string) error {
+func (r *RuijieClient) Login(ctx context.Context, username, password, service string) error {
 	// Check current status
-	isLoggedIn, _, err := r.CheckLoginStatus()
+	isLoggedIn, _, err := r.CheckLoginStatus(ctx)
 	if err != nil {
 		return err
 	}
 
 	if isLoggedIn {
-		r.log("Already logged in")
+		r.logger.Info("Already logged in")
 		return nil
 	}
 
 	// Redirect to portal to get session info
-	sessionInfo, err := r.RedirectToPortal("")
+	sessionInfo, err := r.RedirectToPortal(ctx, "")
 	if err != nil {
 		return err
 	}
-	r.log(fmt.Sprintf("Got session info: %v", sessionInfo))
+	r.logSessionInfo(sessionInfo)
 
-	// CAS-SSO login
-	if err := r.CasSSOLogin(username, password, sessionInfo); err != nil {
-		return fmt.Errorf("CAS-SSO authentication failed: %w", err)
+	// Follow the portal workflow until the user is online
+	state := &workflowState{username: username, password: password, service: service, sessionInfo: sessionInfo}
+	if err := r.runWorkflow(ctx, state); err != nil {
+		return err
 	}
 
-	// Get services
-	services, err := r.ServiceSelection(sessionInfo)
+	// Keep the authenticated cookies for later commands
+	r.saveSession()
+
+	return nil
+}
+
+// switchRollbackTimeout bounds the login to the previous service after a failed switch,
+// it runs even when the command deadline has already expired
+const switchRollbackTimeout = time.Minute
+
+// SwitchService moves the current session to another service by going offline
+// and logging in again. If the new service cannot be logged in, the previous
+// service is restored. It returns the service active before the call and the
+// resolved target service; from is empty when nobody was logged in.
+func (r *RuijieClient) SwitchService(ctx context.Context, username, password, service string) (from, to string, err error) {
+	// Check current status
+	isLoggedIn, userInfo, err := r.CheckLoginStatus(ctx)
 	if err != nil {
-		return err
+		return "", service, err
 	}
-	r.log(fmt.Sprintf("Available services: %v", services))
 
-	// Login to specified service
-	loginResult, err := r.ServiceLogin(sessionInfo, service)
-	if err != nil {
+	if !isLoggedIn {
+		r.logger.Info("Not logged in, logging in directly")
+		return "", service, r.Login(ctx, username, password, service)
+	}
+
+	var current string
+	if userInfo.PortalOnlineUserInfo != nil {
+		current = userInfo.PortalOnlineUserInfo.Service
+	}
+
+	// Resolve the target against the live list before going offline
+	var services *models.ServiceList
+	err = r.withSession(ctx, func(sessionInfo map[string]string) error {
+		var err error
+		services, err = r.ServiceSelection(ctx, sessionInfo)
 		return err
+	})
+	if err != nil {
+		return current, service, err
+	}
+	target, err := r.resolveService(services, service)
+	if err != nil {
+		return current, service, err
+	}
+
+	if target == current {
+		r.logger.Info("Already using service", "service", current)
+		return current, target, nil
+	}
+	r.logger.Info("Switching service", "from", current, "to", target)
+
+	if err := r.Logout(ctx); err != nil {
+		return current, target, fmt.Errorf("failed to go offline: %w", err)
 	}
-	r.log(fmt.Sprintf("Service login result: %v", loginResult))
 
-	// Verify login status
-	onlineStatus, err := r.UserOnline(sessionInfo)
+	// Login short-circuits while the portal still reports the old session
+	isLoggedIn, _, err = r.CheckLoginStatus(ctx)
 	if err != nil {
-		return err
+		return current, target, err
 	}
-	r.log(fmt.Sprintf("User online status: %v", onlineStatus))
-
-	// Check authentication result
-	if code, ok := loginResult["code"].(float64); ok && code == 200 {
-		if data, ok := loginResult["data"].(map[string]interface{}); ok {
-			if authResult, ok := data["authResult"].(string); ok {
-				if authResult == "fail" {
-					authMessage, _ := data["authMessage"].(string)
-					if authMessage == "" {
-						authMessage = "Unknown authentication error"
-					}
-					return fmt.Errorf("authentication failed: %s", authMessage)
-				} else if authResult != "success" {
-					return fmt.Errorf("unexpected authentication result: %s", authResult)
-				}
-			}
-		}
-	} else {
-		return fmt.Errorf("invalid service login response: %v", loginResult)
+	if isLoggedIn {
+		return current, target, errors.New("failed to go offline: portal still reports the session online")
 	}
 
-	// Check online status
-	if online, ok := onlineStatus["online"].(bool); !ok || !online {
-		message, _ := onlineStatus["message"].(string)
-		if message == "" {
-			message = "User is not online after authentication"
-		}
-		return fmt.Errorf("login verification failed: %s", message)
+	loginErr := r.Login(ctx, username, password, target)
+	if loginErr == nil {
+		return current, target, nil
+	}
+	if current == "" {
+		return current, target, loginErr
 	}
 
-	return nil
+	// Restore the previous service
+	r.logger.Warn("Switching service failed, restoring previous service", "service", current, "error", loginErr)
+	rollbackCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), switchRollbackTimeout)
+	defer cancel()
+	if err := r.Login(rollbackCtx, username, password, current); err != nil {
+		return current, target, fmt.Errorf("switching to %s failed: %w (restoring %s also failed: %v)", target, loginErr, current, err)
+	}
+
+	return current, target, fmt.Errorf("switching to %s failed, restored %s: %w", target, current, loginErr)
 }
 
 // Logout performs logout operation
-func (r *RuijieClient) Logout() error {
+func (r *RuijieClient) Logout(ctx context.Context) error {
 	// Check current status
-	isLoggedIn, _, err := r.CheckLoginStatus()
+	isLoggedIn, _, err := r.CheckLoginStatus(ctx)
 	if err != nil {
 		return err
 	}
 
 	if !isLoggedIn {
-		r.log("Already logged out")
+		r.logger.Info("Already logged out")
 		return nil
 	}
 
-	// Redirect to portal to get session info
-	sessionInfo, err := r.RedirectToPortal("")
-	if err != nil {
-		return err
-	}
-	r.log(fmt.Sprintf("Got session info for logout: %v", sessionInfo))
+	return r.withSession(ctx, func(sessionInfo map[string]string) error {
+		r.logger.Debug("Logging out", "sessionId", sessionInfo["sessionId"])
 
-	// Execute logout
-	offlineResult, err := r.Offline(sessionInfo)
-	if err != nil {
-		return err
-	}
-	r.log(fmt.Sprintf("Offline result: %v", offlineResult))
+		// Execute logout
+		if err := r.Offline(ctx, sessionInfo); err != nil {
+			return err
+		}
 
-	// Verify logout status
-	finalStatus, err := r.UserOnline(sessionInfo)
-	if err != nil {
-		return err
-	}
-	r.log(fmt.Sprintf("Final user status: %v", finalStatus))
+		// The portal session and CAS ticket are no use once offline
+		r.clearSession()
 
-	return nil
+		// Verify logout status
+		finalStatus, err := r.UserOnline(ctx, sessionInfo)
+		if err != nil {
+			return err
+		}
+		r.logger.Debug("Checked online status after logout", "online", finalStatus.Online, "message", finalStatus.Message)
+
+		return nil
+	})
+}
+
+// CurrentAccountInfo gets account information for the current session
+func (r *RuijieClient) CurrentAccountInfo(ctx context.Context) (*models.AccountInfo, error) {
+	var accountInfo *models.AccountInfo
+	err := r.withSession(ctx, func(sessionInfo map[string]string) error {
+		var err error
+		accountInfo, err = r.GetAccountInfo(ctx, sessionInfo)
+		return err
+	})
+	return accountInfo, err
 }
@@ -0,0 +1,187 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"ruijie-go/internal/client"
+	"ruijie-go/internal/mockportal"
+)
+
+// startPortal runs a mock portal with the given failure rules for the duration of the test
+func startPortal(t *testing.T, rules ...string) *mockportal.Server {
+	t.Helper()
+
+	portal := mockportal.New(mockportal.Options{Delay: time.Second})
+	for _, spec := range rules {
+		rule, err := mockportal.ParseRule(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		portal.AddRule(rule)
+	}
+	portal.Start(nil)
+	t.Cleanup(portal.Close)
+	return portal
+}
+
+// newClient creates a client for the mock portal that retries without noticeable delays
+func newClient(portal *mockportal.Server, opts ...client.Option) *client.RuijieClient {
+	opts = append([]client.Option{
+		client.WithPortal(client.Portal{BaseURL: portal.URL}),
+		client.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		client.WithStepTimeout(300 * time.Millisecond),
+		client.WithRetryPolicy(client.RetryPolicy{Attempts: 2, Backoff: time.Millisecond, MaxBackoff: time.Millisecond}),
+	}, opts...)
+	return client.NewRuijieClient(nil, false, opts...)
+}
+
+// fixedCaptcha answers every captcha with the same code
+type fixedCaptcha string
+
+func (c fixedCaptcha) SolveCaptcha(ctx context.Context, imageData []byte) (string, error) {
+	return string(c), nil
+}
+
+func TestLogin(t *testing.T) {
+	portal := startPortal(t)
+	ruijie := newClient(portal)
+
+	if err := ruijie.Login(context.Background(), "test", "test", "中国电信"); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if online, service := portal.Online(); !online || service != "中国电信" {
+		t.Errorf("portal reports online=%v service=%q, want online to 中国电信", online, service)
+	}
+
+	online, info, err := ruijie.CheckLoginStatus(context.Background())
+	if err != nil {
+		t.Fatalf("CheckLoginStatus: %v", err)
+	}
+	if !online || info.PortalOnlineUserInfo.Service != "中国电信" {
+		t.Errorf("CheckLoginStatus = %v, %+v, want online to 中国电信", online, info.PortalOnlineUserInfo)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	portal := startPortal(t)
+	ruijie := newClient(portal)
+	if err := ruijie.Login(context.Background(), "test", "test", "校园网"); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	if err := ruijie.Logout(context.Background()); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+	if online, _ := portal.Online(); online {
+		t.Error("portal still reports the user online")
+	}
+
+	online, _, err := ruijie.CheckLoginStatus(context.Background())
+	if err != nil || online {
+		t.Errorf("CheckLoginStatus = %v, %v, want offline", online, err)
+	}
+}
+
+func TestSwitchService(t *testing.T) {
+	portal := startPortal(t)
+	ruijie := newClient(portal)
+	if err := ruijie.Login(context.Background(), "test", "test", "校园网"); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	from, to, err := ruijie.SwitchService(context.Background(), "test", "test", "中国移动")
+	if err != nil {
+		t.Fatalf("SwitchService: %v", err)
+	}
+	if from != "校园网" || to != "中国移动" {
+		t.Errorf("SwitchService = %q -> %q, want 校园网 -> 中国移动", from, to)
+	}
+	if _, service := portal.Online(); service != "中国移动" {
+		t.Errorf("portal reports service %q, want 中国移动", service)
+	}
+}
+
+func TestLoginRecovers(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []string
+		opts  []client.Option
+	}{
+		{"captcha solved", []string{"cas-sso=captcha:1"}, []client.Option{client.WithCaptchaSolver(fixedCaptcha("1234"))}},
+		{"expired form", []string{"cas-sso=expired:1"}, nil},
+		{"transient server error", []string{"serviceLogin=5xx:1"}, nil},
+		{"slow step", []string{"userOnline=slow:1"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			portal := startPortal(t, tt.rules...)
+			if err := newClient(portal, tt.opts...).Login(context.Background(), "test", "test", "校园网"); err != nil {
+				t.Fatalf("Login: %v", err)
+			}
+			if online, _ := portal.Online(); !online {
+				t.Error("portal reports the user offline")
+			}
+		})
+	}
+}
+
+func TestLoginFailures(t *testing.T) {
+	tests := []struct {
+		rule string
+		kind error
+	}{
+		{"cas-sso=" + mockportal.FailWrongPassword, client.ErrBadCredentials},
+		{"cas-sso=" + mockportal.FailCaptcha, client.ErrCaptchaRequired},
+		{"cas-sso=" + mockportal.FailExpired, client.ErrUnexpectedSchema},
+		{"serviceLogin=" + mockportal.FailSlow, client.ErrPortalUnreachable},
+		{"serviceLogin=" + mockportal.FailMalformedJSON, client.ErrUnexpectedSchema},
+		{"serviceLogin=" + mockportal.FailServerError, client.ErrPortalUnreachable},
+		{"getOnlineUserInfo=" + mockportal.FailMalformedJSON, client.ErrUnexpectedSchema},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			portal := startPortal(t, tt.rule)
+			err := newClient(portal).Login(context.Background(), "test", "test", "校园网")
+
+			var portalErr *client.PortalError
+			if !errors.As(err, &portalErr) || !errors.Is(err, tt.kind) {
+				t.Fatalf("Login error = %v, want a PortalError of kind %v", err, tt.kind)
+			}
+			if online, _ := portal.Online(); online {
+				t.Error("portal reports the user online")
+			}
+		})
+	}
+}
+
+func TestLoginStopsAtUnexpectedPortalSteps(t *testing.T) {
+	tests := []struct {
+		rule string
+		err  string // Part of the expected error
+	}{
+		{"getCurrentNode=" + mockportal.FailUnknownNode, "unsupported portal step /portal_auth/smsVerify"},
+		{"getCurrentNode=" + mockportal.FailStuckNode, "portal step /portal_auth/casSso did not advance"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			portal := startPortal(t, tt.rule)
+			err := newClient(portal).Login(context.Background(), "test", "test", "校园网")
+
+			if !errors.Is(err, client.ErrUnexpectedSchema) || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("Login error = %v, want ErrUnexpectedSchema containing %q", err, tt.err)
+			}
+			if online, _ := portal.Online(); online {
+				t.Error("portal reports the user online")
+			}
+		})
+	}
+}
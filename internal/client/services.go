@@ -0,0 +1,59 @@
+package client
+
+import (
+	"ruijie-go/internal/models"
+)
+
+// ServiceResolver maps the requested service (number, alias, ...) onto a
+// name of the service list the portal just returned
+type ServiceResolver interface {
+	ResolveService(services *models.ServiceList, input string) (string, error)
+}
+
+// ServiceCache remembers the last service list so later invocations can
+// number and resolve services without asking the portal
+type ServiceCache interface {
+	SaveServices(services *models.ServiceList) error
+}
+
+// WithServiceResolver sets how the requested service is matched against the live list
+func WithServiceResolver(resolver ServiceResolver) Option {
+	return func(r *RuijieClient) {
+		r.serviceResolver = resolver
+	}
+}
+
+// WithServiceCache stores every service list fetched from the portal
+func WithServiceCache(cache ServiceCache) Option {
+	return func(r *RuijieClient) {
+		r.serviceCache = cache
+	}
+}
+
+// cacheServices saves the service list if a cache is configured
+func (r *RuijieClient) cacheServices(services *models.ServiceList) {
+	if r.serviceCache == nil || len(services.Services) == 0 {
+		return
+	}
+	if err := r.serviceCache.SaveServices(services); err != nil {
+		r.logger.Warn("Failed to cache service list", "error", err)
+	}
+}
+
+// resolveService matches the requested service against the live list,
+// without a resolver the request is passed to the portal unchanged
+func (r *RuijieClient) resolveService(services *models.ServiceList, service string) (string, error) {
+	if r.serviceResolver == nil {
+		return service, nil
+	}
+
+	name, err := r.serviceResolver.ResolveService(services, service)
+	if err != nil {
+		return "", newPortalError(ErrServiceUnavailable, "service selection failed", err)
+	}
+	if name != service {
+		r.logger.Debug("Resolved service", "requested", service, "service", name)
+	}
+
+	return name, nil
+}
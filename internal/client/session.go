@@ -0,0 +1,283 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sessionMaxAge is how long saved session info and cookies without an expiry
+// are trusted before the full flow runs again
+const sessionMaxAge = 24 * time.Hour
+
+// Session is the portal state kept between CLI invocations
+type Session struct {
+	PortalURL   string            `json:"portalUrl"`
+	SessionInfo map[string]string `json:"sessionInfo"`
+	Cookies     []*SavedCookie    `json:"cookies"`
+	SavedAt     time.Time         `json:"savedAt"`
+}
+
+// SavedCookie is a portal cookie with its Domain, Path and Expires filled in
+type SavedCookie struct {
+	http.Cookie
+	HostOnly bool `json:"hostOnly,omitempty"` // Set without a Domain attribute, so not sent to subdomains
+}
+
+// SessionStore loads and saves the portal session
+type SessionStore interface {
+	Load() (*Session, error)
+	Save(session *Session) error
+	Clear() error
+}
+
+// FileSessionStore keeps the session in a JSON file readable only by the owner
+type FileSessionStore struct {
+	Path string
+}
+
+// NewFileSessionStore creates a session store backed by the given file
+func NewFileSessionStore(path string) *FileSessionStore {
+	return &FileSessionStore{Path: path}
+}
+
+// Load reads the session file, a missing file yields a nil session
+func (s *FileSessionStore) Load() (*Session, error) {
+	data, err := os.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session file: %w", err)
+	}
+
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("failed to parse session file: %w", err)
+	}
+
+	return &session, nil
+}
+
+// Save atomically replaces the session file with 0600 permissions
+func (s *FileSessionStore) Save(session *Session) error {
+	data, err := json.MarshalIndent(session, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode session: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0700); err != nil {
+		return fmt.Errorf("failed to create session directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.Path), ".session-*")
+	if err != nil {
+		return fmt.Errorf("failed to create session file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to restrict session file permissions: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write session file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write session file: %w", err)
+	}
+
+	return os.Rename(tmp.Name(), s.Path)
+}
+
+// Clear removes the session file
+func (s *FileSessionStore) Clear() error {
+	if err := os.Remove(s.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove session file: %w", err)
+	}
+	return nil
+}
+
+// WithSessionStore restores the saved portal session and keeps it up to date
+func WithSessionStore(store SessionStore) Option {
+	return func(r *RuijieClient) {
+		r.sessionStore = store
+	}
+}
+
+// restoreSession loads the saved session if it belongs to the configured
+// portal. Cookies are restored until they expire, cookies without an expiry
+// and the session info only while the session is recent enough.
+func (r *RuijieClient) restoreSession() {
+	session, err := r.sessionStore.Load()
+	if err != nil {
+		r.logger.Debug("Ignoring saved session", "error", err)
+		return
+	}
+	if session == nil || session.PortalURL != r.portal.BaseURL {
+		return
+	}
+
+	recent := time.Since(session.SavedAt) <= sessionMaxAge
+	scheme := "https"
+	if portalURL, err := url.Parse(r.portal.BaseURL); err == nil {
+		scheme = portalURL.Scheme
+	}
+	for _, saved := range session.Cookies {
+		if saved.Expires.IsZero() && !recent || !saved.Expires.IsZero() && time.Now().After(saved.Expires) {
+			continue
+		}
+		cookie := saved.Cookie
+		if saved.HostOnly {
+			// Without Domain the jar scopes the cookie to the host of the URL again
+			cookie.Domain = ""
+		}
+		r.jar.SetCookies(&url.URL{Scheme: scheme, Host: saved.Domain, Path: saved.Path}, []*http.Cookie{&cookie})
+	}
+	if recent && len(session.SessionInfo) > 0 {
+		r.sessionInfo = session.SessionInfo
+	}
+	r.logger.Debug("Restored saved session", "savedAt", session.SavedAt.Format(time.RFC3339), "cookies", len(session.Cookies))
+}
+
+// saveSession persists the current session info and all portal cookies,
+// including the CAS ticket cookie scoped to the cas-sso path
+func (r *RuijieClient) saveSession() {
+	if r.sessionStore == nil {
+		return
+	}
+
+	session := &Session{
+		PortalURL:   r.portal.BaseURL,
+		SessionInfo: r.sessionInfo,
+		Cookies:     r.jar.AllCookies(),
+		SavedAt:     time.Now(),
+	}
+	if err := r.sessionStore.Save(session); err != nil {
+		r.logger.Warn("Failed to save session", "error", err)
+	}
+}
+
+// clearSession forgets the session info and removes the saved session
+func (r *RuijieClient) clearSession() {
+	r.sessionInfo = nil
+	if r.sessionStore == nil {
+		return
+	}
+	if err := r.sessionStore.Clear(); err != nil {
+		r.logger.Warn("Failed to clear session", "error", err)
+	}
+}
+
+// sessionJar is a cookie jar that also remembers the domain, path, expiry and
+// host-only flag of each cookie, which the standard jar does not hand out again
+type sessionJar struct {
+	*cookiejar.Jar
+
+	mu      sync.Mutex
+	cookies map[string]*SavedCookie // Keyed by domain, path and name
+}
+
+// newSessionJar creates an empty cookie jar
+func newSessionJar() *sessionJar {
+	jar, _ := cookiejar.New(nil)
+	return &sessionJar{Jar: jar, cookies: map[string]*SavedCookie{}}
+}
+
+// SetCookies implements http.CookieJar
+func (j *sessionJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.Jar.SetCookies(u, cookies)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	for _, cookie := range cookies {
+		saved := SavedCookie{Cookie: *cookie, HostOnly: cookie.Domain == ""}
+		saved.Raw, saved.Unparsed = "", nil
+		saved.Domain = strings.TrimPrefix(saved.Domain, ".")
+		if saved.HostOnly {
+			saved.Domain = u.Hostname()
+		}
+		if !strings.HasPrefix(saved.Path, "/") {
+			saved.Path = defaultCookiePath(u.Path)
+		}
+		if saved.MaxAge > 0 {
+			saved.Expires = now.Add(time.Duration(saved.MaxAge) * time.Second)
+		}
+
+		key := saved.Domain + ";" + saved.Path + ";" + saved.Name
+		if saved.MaxAge < 0 || !saved.Expires.IsZero() && !saved.Expires.After(now) {
+			delete(j.cookies, key)
+			continue
+		}
+		saved.MaxAge = 0
+		j.cookies[key] = &saved
+	}
+}
+
+// AllCookies returns the unexpired cookies of every domain and path
+func (j *sessionJar) AllCookies() []*SavedCookie {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	cookies := make([]*SavedCookie, 0, len(j.cookies))
+	for _, cookie := range j.cookies {
+		if cookie.Expires.IsZero() || cookie.Expires.After(now) {
+			cookies = append(cookies, cookie)
+		}
+	}
+	return cookies
+}
+
+// defaultCookiePath returns the path a cookie without a Path attribute is scoped to (RFC 6265 5.1.4)
+func defaultCookiePath(path string) string {
+	i := strings.LastIndex(path, "/")
+	if i <= 0 {
+		return "/"
+	}
+	return path[:i]
+}
+
+// isStaleSession reports whether an error means the portal no longer accepts the session
+func isStaleSession(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) || errors.Is(err, ErrUnexpectedSchema)
+}
+
+// GetSessionInfo returns the portal session info, reusing the saved session when available
+func (r *RuijieClient) GetSessionInfo(ctx context.Context) (map[string]string, error) {
+	if r.sessionInfo != nil {
+		return r.sessionInfo, nil
+	}
+	return r.RedirectToPortal(ctx, "")
+}
+
+// withSession runs fn with the saved session info and repeats it once with a
+// fresh portal session if the saved one has been rejected
+func (r *RuijieClient) withSession(ctx context.Context, fn func(sessionInfo map[string]string) error) error {
+	if cached := r.sessionInfo; cached != nil {
+		err := fn(cached)
+		if err == nil || !isStaleSession(err) {
+			return err
+		}
+		r.logger.Debug("Saved session rejected, redirecting to portal again", "error", err)
+		r.sessionInfo = nil
+	}
+
+	sessionInfo, err := r.RedirectToPortal(ctx, "")
+	if err != nil {
+		return err
+	}
+	return fn(sessionInfo)
+}
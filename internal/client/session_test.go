@@ -0,0 +1,162 @@
+package client
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"ruijie-go/internal/logging"
+)
+
+// portalURL is the portal of the saved sessions
+const portalURL = "http://portal.example"
+
+// restoreClient creates a client that restores the session saved in store
+func restoreClient(store SessionStore) *RuijieClient {
+	return NewRuijieClient(nil, false,
+		WithPortal(Portal{BaseURL: portalURL}),
+		WithLogger(logging.Discard()),
+		WithSessionStore(store),
+	)
+}
+
+// cookieNames returns the sorted names of the cookies the client sends to rawURL
+func cookieNames(r *RuijieClient, rawURL string) []string {
+	u, _ := url.Parse(rawURL)
+	var names []string
+	for _, cookie := range r.jar.Cookies(u) {
+		names = append(names, cookie.Name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestSessionKeepsHostOnlyCookies(t *testing.T) {
+	store := NewFileSessionStore(filepath.Join(t.TempDir(), "session.json"))
+	r := restoreClient(store)
+
+	u, _ := url.Parse(portalURL + "/cas-sso/login")
+	r.jar.SetCookies(u, []*http.Cookie{
+		{Name: "JSESSIONID", Value: "host", Path: "/"},
+		{Name: "domain", Value: "domain", Path: "/", Domain: ".portal.example"},
+	})
+	r.saveSession()
+
+	restored := restoreClient(store)
+	for rawURL, want := range map[string][]string{
+		portalURL + "/":               {"JSESSIONID", "domain"},
+		"http://auth.portal.example/": {"domain"},
+	} {
+		if got := cookieNames(restored, rawURL); !slices.Equal(got, want) {
+			t.Errorf("cookies sent to %s = %v, want %v", rawURL, got, want)
+		}
+	}
+}
+
+func TestSessionDropsExpiredCookies(t *testing.T) {
+	now := time.Now()
+	store := NewFileSessionStore(filepath.Join(t.TempDir(), "session.json"))
+
+	tests := []struct {
+		name    string
+		savedAt time.Time
+		want    []string // Restored cookies
+	}{
+		{"recent", now.Add(-time.Hour), []string{"persistent", "session"}},
+		{"old", now.Add(-2 * sessionMaxAge), []string{"persistent"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := store.Save(&Session{
+				PortalURL:   portalURL,
+				SessionInfo: map[string]string{"sessionId": "abc"},
+				SavedAt:     tt.savedAt,
+				Cookies: []*SavedCookie{
+					{Cookie: http.Cookie{Name: "persistent", Value: "1", Domain: "portal.example", Path: "/", Expires: now.Add(time.Hour)}, HostOnly: true},
+					{Cookie: http.Cookie{Name: "expired", Value: "1", Domain: "portal.example", Path: "/", Expires: now.Add(-time.Hour)}, HostOnly: true},
+					{Cookie: http.Cookie{Name: "session", Value: "1", Domain: "portal.example", Path: "/"}, HostOnly: true},
+				},
+			})
+			if err != nil {
+				t.Fatalf("Save: %v", err)
+			}
+
+			r := restoreClient(store)
+			if got := cookieNames(r, portalURL+"/"); !slices.Equal(got, tt.want) {
+				t.Errorf("restored cookies = %v, want %v", got, tt.want)
+			}
+			if recent := tt.name == "recent"; (r.sessionInfo != nil) != recent {
+				t.Errorf("session info restored = %v, want %v", r.sessionInfo, recent)
+			}
+		})
+	}
+}
+
+func TestSessionOfOtherPortalIgnored(t *testing.T) {
+	store := NewFileSessionStore(filepath.Join(t.TempDir(), "session.json"))
+	err := store.Save(&Session{
+		PortalURL:   "http://other.example",
+		SessionInfo: map[string]string{"sessionId": "abc"},
+		SavedAt:     time.Now(),
+		Cookies:     []*SavedCookie{{Cookie: http.Cookie{Name: "JSESSIONID", Value: "1", Domain: "portal.example", Path: "/"}, HostOnly: true}},
+	})
+	if err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	r := restoreClient(store)
+	if names := cookieNames(r, portalURL+"/"); len(names) != 0 || r.sessionInfo != nil {
+		t.Errorf("session of another portal restored: cookies %v, info %v", names, r.sessionInfo)
+	}
+}
+
+func TestFileSessionStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "session.json")
+	store := NewFileSessionStore(path)
+
+	if session, err := store.Load(); session != nil || err != nil {
+		t.Errorf("Load of a missing file = %v, %v, want no session", session, err)
+	}
+
+	// An existing file with a wider mode is replaced by a private one
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	saved := &Session{PortalURL: portalURL, SessionInfo: map[string]string{"sessionId": "abc"}, SavedAt: time.Now().Round(0)}
+	if err := store.Save(saved); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("session file mode = %o, want 600", mode)
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(filepath.Dir(path), ".session-*")); len(leftovers) != 0 {
+		t.Errorf("temporary files left behind: %v", leftovers)
+	}
+
+	loaded, err := store.Load()
+	if err != nil || loaded == nil || loaded.SessionInfo["sessionId"] != "abc" || !loaded.SavedAt.Equal(saved.SavedAt) {
+		t.Errorf("Load = %+v, %v, want the saved session", loaded, err)
+	}
+
+	if err := store.Clear(); err != nil {
+		t.Fatalf("Clear: %v", err)
+	}
+	if err := store.Clear(); err != nil {
+		t.Errorf("Clear of a missing file: %v", err)
+	}
+	if session, err := store.Load(); session != nil || err != nil {
+		t.Errorf("Load after Clear = %v, %v, want no session", session, err)
+	}
+}
@@ -0,0 +1,91 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// WithInterface binds portal connections to a network interface, e.g. eth1
+func WithInterface(name string) Option {
+	return func(r *RuijieClient) {
+		r.iface = name
+	}
+}
+
+// WithSourceIP binds portal connections to a local address
+func WithSourceIP(ip string) Option {
+	return func(r *RuijieClient) {
+		r.sourceIP = ip
+	}
+}
+
+// newTransport creates the HTTP transport with the configured proxies, bound
+// to the configured interface or source address if any
+func (r *RuijieClient) newTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxyFunc(r.proxies)
+	if r.iface == "" && r.sourceIP == "" {
+		return transport
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	// Binding problems surface on the first request like any other dial error
+	bindErr := r.bindDialer(dialer)
+	transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		if bindErr != nil {
+			return nil, bindErr
+		}
+		return dialer.DialContext(ctx, network, address)
+	}
+
+	return transport
+}
+
+// bindDialer applies the interface and source address to a dialer
+func (r *RuijieClient) bindDialer(dialer *net.Dialer) error {
+	if r.sourceIP != "" {
+		ip := net.ParseIP(r.sourceIP)
+		if ip == nil {
+			return fmt.Errorf("invalid source IP: %s", r.sourceIP)
+		}
+		dialer.LocalAddr = &net.TCPAddr{IP: ip}
+	}
+
+	if r.iface != "" {
+		if _, err := net.InterfaceByName(r.iface); err != nil {
+			return fmt.Errorf("invalid interface %s: %w", r.iface, err)
+		}
+		return bindToInterface(dialer, r.iface)
+	}
+
+	return nil
+}
+
+// proxyFunc selects the proxy of each request from the proxies map. The
+// "http" and "https" entries are used per scheme and may be http(s) or
+// socks5 URLs with credentials, "no" holds a NO_PROXY style exclusion list.
+// An empty map connects directly.
+func proxyFunc(proxies map[string]string) func(*http.Request) (*url.URL, error) {
+	if proxies["http"] == "" && proxies["https"] == "" {
+		return nil
+	}
+
+	proxyForURL := (&httpproxy.Config{
+		HTTPProxy:  proxies["http"],
+		HTTPSProxy: proxies["https"],
+		NoProxy:    proxies["no"],
+	}).ProxyFunc()
+
+	return func(req *http.Request) (*url.URL, error) {
+		return proxyForURL(req.URL)
+	}
+}
@@ -0,0 +1,163 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"ruijie-go/internal/models"
+)
+
+// Portal workflow nodes reported by workFlow/getCurrentNode
+const (
+	NodeCasSSO           = "casSso"
+	NodeServiceSelection = "serviceSelection"
+	NodeSuccess          = "success"
+)
+
+// maxWorkflowSteps bounds the number of nodes a single login may pass through
+const maxWorkflowSteps = 10
+
+// workflowState is threaded through the node handlers of one login
+type workflowState struct {
+	username    string
+	password    string
+	service     string
+	sessionInfo map[string]string
+}
+
+// nodeHandler performs the step of one workflow node. It returns the node
+// expected next, which is used when the portal does not report one; an empty
+// node ends the workflow.
+type nodeHandler func(ctx context.Context, r *RuijieClient, state *workflowState) (string, error)
+
+// workflowNodes maps the normalized names of the nodes seen on the portal onto
+// their handlers. Any other node fails as an unsupported portal step rather
+// than being guessed at.
+var workflowNodes = map[string]nodeHandler{
+	normalizeNode(NodeCasSSO):           handleCasSSO,
+	normalizeNode(NodeServiceSelection): handleServiceSelection,
+	normalizeNode(NodeSuccess):          handleSuccess,
+}
+
+// normalizeNode reduces a node path such as "/portal_auth/casSso" to "cassso"
+func normalizeNode(path string) string {
+	path = strings.TrimRight(path, "/")
+	if i := strings.LastIndex(path, "/"); i >= 0 {
+		path = path[i+1:]
+	}
+	return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(path))
+}
+
+// runWorkflow walks the portal workflow from the CAS login to the online
+// check, following the node the portal reports before every step
+func (r *RuijieClient) runWorkflow(ctx context.Context, state *workflowState) error {
+	node := NodeCasSSO
+	previous := ""
+	for step := 0; step < maxWorkflowSteps; step++ {
+		// The reported node wins over the one the previous handler expected
+		current, err := r.getCurrentNode(ctx, state.sessionInfo, "portal_auth")
+		if err != nil {
+			r.logger.Debug("Current workflow node unknown, assuming expected node", "node", node, "error", err)
+		} else if current.CurrentNodePath != "" {
+			node = current.CurrentNodePath
+		}
+
+		if normalizeNode(node) == previous {
+			return newPortalError(ErrUnexpectedSchema, "login failed", fmt.Errorf("portal step %s did not advance", node))
+		}
+		handler, ok := workflowNodes[normalizeNode(node)]
+		if !ok {
+			return newPortalError(ErrUnexpectedSchema, "login failed", fmt.Errorf("unsupported portal step %s", node))
+		}
+		r.logger.Debug("Running workflow step", "node", node)
+
+		next, err := handler(ctx, r, state)
+		if err != nil {
+			return err
+		}
+		if next == "" {
+			return nil
+		}
+		previous = normalizeNode(node)
+		node = next
+	}
+
+	return newPortalError(ErrUnexpectedSchema, "login failed", fmt.Errorf("portal workflow did not finish after %d steps", maxWorkflowSteps))
+}
+
+// handleCasSSO authenticates the user on the CAS-SSO page
+func handleCasSSO(ctx context.Context, r *RuijieClient, state *workflowState) (string, error) {
+	if err := r.CasSSOLogin(ctx, state.username, state.password, state.sessionInfo); err != nil {
+		return "", fmt.Errorf("CAS-SSO authentication failed: %w", err)
+	}
+	return NodeServiceSelection, nil
+}
+
+// handleServiceSelection picks the requested service from the live list and logs in to it
+func handleServiceSelection(ctx context.Context, r *RuijieClient, state *workflowState) (string, error) {
+	// Get services
+	services, err := r.ServiceSelection(ctx, state.sessionInfo)
+	if err != nil {
+		return "", err
+	}
+	r.logger.Debug("Fetched available services", "services", services.Names())
+
+	// Match the requested service against the live list
+	service, err := r.resolveService(services, state.service)
+	if err != nil {
+		return "", err
+	}
+	state.service = service
+
+	// Login to specified service
+	loginResult, err := r.ServiceLogin(ctx, state.sessionInfo, service)
+	if err != nil {
+		return "", err
+	}
+	r.logger.Debug("Service login finished", "result", loginResult.AuthResult, "message", loginResult.AuthMessage)
+
+	if err := checkLoginResult(loginResult); err != nil {
+		return "", err
+	}
+	return NodeSuccess, nil
+}
+
+// handleSuccess verifies that the portal reports the user online
+func handleSuccess(ctx context.Context, r *RuijieClient, state *workflowState) (string, error) {
+	onlineStatus, err := r.UserOnline(ctx, state.sessionInfo)
+	if err != nil {
+		return "", err
+	}
+	r.logger.Debug("Checked online status", "online", onlineStatus.Online, "message", onlineStatus.Message)
+
+	if !onlineStatus.Online {
+		message := onlineStatus.Message
+		if message == "" {
+			message = "User is not online after authentication"
+		}
+		return "", newPortalError(ErrServiceUnavailable, "login verification failed", errors.New(message))
+	}
+	return "", nil
+}
+
+// checkLoginResult turns a failed service login into a categorised error
+func checkLoginResult(loginResult *models.ServiceLoginResult) error {
+	switch loginResult.AuthResult {
+	case "success":
+		return nil
+	case "fail":
+		authMessage := loginResult.AuthMessage
+		if authMessage == "" {
+			authMessage = "Unknown authentication error"
+		}
+		kind := classifyMessage(authMessage)
+		if kind == nil {
+			kind = ErrServiceUnavailable
+		}
+		return newPortalError(kind, "authentication failed", errors.New(authMessage))
+	default:
+		return newPortalError(ErrUnexpectedSchema, "unexpected authentication result", errors.New(loginResult.AuthResult))
+	}
+}
@@ -0,0 +1,69 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// stepTo returns a node handler that records its node in visited and expects next
+func stepTo(visited *[]string, node, next string) nodeHandler {
+	return func(ctx context.Context, r *RuijieClient, state *workflowState) (string, error) {
+		*visited = append(*visited, node)
+		return next, nil
+	}
+}
+
+func TestRunWorkflow(t *testing.T) {
+	tests := []struct {
+		name  string
+		nodes map[string]string // Node to the node its handler expects next
+		steps int               // Handlers run
+		err   string            // Part of the expected error, empty on success
+	}{
+		{"finishes", map[string]string{NodeCasSSO: "second", "second": ""}, 2, ""},
+		{"node did not advance", map[string]string{NodeCasSSO: "/portal_auth/cas_sso"}, 1, "portal step /portal_auth/cas_sso did not advance"},
+		{"unsupported node", map[string]string{NodeCasSSO: "smsVerify"}, 1, "unsupported portal step smsVerify"},
+		{"endless workflow", map[string]string{NodeCasSSO: "ping", "ping": NodeCasSSO}, maxWorkflowSteps, "did not finish after 10 steps"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var visited []string
+			nodes := map[string]nodeHandler{}
+			for node, next := range tt.nodes {
+				nodes[normalizeNode(node)] = stepTo(&visited, node, next)
+			}
+			saved := workflowNodes
+			workflowNodes = nodes
+			t.Cleanup(func() { workflowNodes = saved })
+
+			// The portal reports no node, so the expected ones are followed
+			r, _ := countingPortal(t, status(http.StatusNotFound))
+			err := r.runWorkflow(context.Background(), &workflowState{})
+
+			if tt.err == "" && err != nil {
+				t.Fatalf("runWorkflow: %v", err)
+			}
+			if tt.err != "" && (!errors.Is(err, ErrUnexpectedSchema) || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("runWorkflow error = %v, want ErrUnexpectedSchema containing %q", err, tt.err)
+			}
+			if len(visited) != tt.steps || visited[0] != NodeCasSSO {
+				t.Errorf("visited %v, want %d steps starting at %s", visited, tt.steps, NodeCasSSO)
+			}
+		})
+	}
+}
+
+func TestNormalizeNode(t *testing.T) {
+	var got []string
+	for _, path := range []string{"/portal_auth/casSso", "cas-sso", "/portal_auth/serviceSelection/", "SUCCESS"} {
+		got = append(got, normalizeNode(path))
+	}
+	if want := []string{"cassso", "cassso", "serviceselection", "success"}; !slices.Equal(got, want) {
+		t.Errorf("normalizeNode = %v, want %v", got, want)
+	}
+}
@@ -2,10 +2,18 @@ package config
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"strings"
 	"syscall"
+	"time"
+
+	"ruijie-go/internal/client"
+	"ruijie-go/internal/models"
+	"ruijie-go/internal/services"
+	"ruijie-go/internal/vault"
 
 	"github.com/spf13/viper"
 	"golang.org/x/term"
@@ -13,23 +21,65 @@ import (
 
 // Config holds all configuration for the application
 type Config struct {
+	Profile  string // Name of the applied profile, empty if none
 	Username string
 	Password string
 	Service  string
 	Proxies  map[string]string
 	Verbose  bool
+	Portal   PortalConfig
+	Captcha  CaptchaConfig
+
+	Timeout     time.Duration // Deadline of a whole command, zero disables it
+	StepTimeout time.Duration // Deadline of a single portal step
+	Retry       RetryConfig
+
+	StateFile string // File holding the portal session between runs, empty disables it
+
+	RecordDir string // Directory portal exchanges are recorded to, empty disables recording
+	ReplayDir string // Directory portal exchanges are replayed from, empty uses the network
+	HARFile   string // HAR file portal exchanges are written to, empty disables it
+
+	ServiceAliases   map[string]string // User-defined service aliases
+	ServiceCacheFile string            // File holding the last service list, empty disables it
+
+	Interface string // Network interface portal traffic is bound to
+	SourceIP  string // Local address portal traffic is bound to
+
+	Output string // Output format of reports: text, json or yaml
+
+	PasswordCommand string // Command printing the password, e.g. "pass show ysu"
+	PasswordFile    string // File holding the password, e.g. a Docker secret
+	VaultFile       string // Encrypted credential vault, empty disables it
+
+	vault         *vault.Vault // Unlocked vault, nil until opened
+	vaultErr      error        // Why the vault could not be opened, e.g. vault.ErrPassphraseRequired
+	vaultPassword bool         // Password was taken from the vault
 }
 
-// ServiceMapping maps aliases to actual service names
-var ServiceMapping = map[string]string{
-	"campus":  "校园网",
-	"unicom":  "中国联通",
-	"telecom": "中国电信",
-	"mobile":  "中国移动",
-	"1":       "校园网",
-	"2":       "中国联通",
-	"3":       "中国电信",
-	"4":       "中国移动",
+// PortalConfig holds the portal endpoints, empty fields use the built-in defaults
+type PortalConfig struct {
+	BaseURL     string
+	EportalPath string
+	CasSSOPath  string
+	RedirectURL string
+}
+
+// RetryConfig controls retries of transient portal failures, zero fields use the defaults
+type RetryConfig struct {
+	Attempts    int           // Attempts per portal step, 1 disables retries
+	Backoff     time.Duration // Delay before the first retry
+	MaxBackoff  time.Duration // Upper bound for a single delay
+	Jitter      float64       // Fraction of the delay that is randomised
+	StatusCodes []int         // HTTP status codes treated as transient
+}
+
+// CaptchaConfig selects how captchas on the CAS login page are solved
+type CaptchaConfig struct {
+	Solver  string // interactive, command, http or none
+	Command string // Command for the "command" solver, reads the image on stdin
+	URL     string // Endpoint for the "http" solver
+	Display string // Display mode of the interactive solver: ascii, file or both
 }
 
 // NewConfig creates a new configuration instance
@@ -42,24 +92,112 @@ func NewConfig() *Config {
 
 // LoadFromViper loads configuration from viper (environment variables and config files)
 func (c *Config) LoadFromViper() {
+	c.Profile = strings.ToLower(viper.GetString("profile"))
 	c.Username = viper.GetString("username")
 	c.Password = viper.GetString("password")
 	c.Service = viper.GetString("service")
 	c.Verbose = viper.GetBool("verbose")
+	c.Output = viper.GetString("output")
+	c.Timeout = viper.GetDuration("timeout")
+	c.StepTimeout = viper.GetDuration("step_timeout")
+
+	// Load session state location, "none" disables persistence
+	c.StateFile = viper.GetString("state_file")
+	if c.StateFile == "" {
+		c.StateFile = DefaultStateFile()
+	} else if c.StateFile == "none" {
+		c.StateFile = ""
+	}
+
+	c.RecordDir = viper.GetString("record")
+	c.ReplayDir = viper.GetString("replay")
+	c.HARFile = viper.GetString("har")
+
+	c.ServiceAliases = viper.GetStringMapString("service_aliases")
+	c.ServiceCacheFile = viper.GetString("service_cache")
+	if c.ServiceCacheFile == "" {
+		c.ServiceCacheFile = DefaultServiceCacheFile()
+	} else if c.ServiceCacheFile == "none" {
+		c.ServiceCacheFile = ""
+	}
+
+	// Load network binding
+	c.Interface = viper.GetString("interface")
+	c.SourceIP = viper.GetString("source_ip")
+
+	// Load portal endpoints
+	c.Portal.BaseURL = viper.GetString("portal.base_url")
+	c.Portal.EportalPath = viper.GetString("portal.eportal_path")
+	c.Portal.CasSSOPath = viper.GetString("portal.cas_sso_path")
+	c.Portal.RedirectURL = viper.GetString("portal.redirect_url")
+
+	// Load retry policy
+	c.Retry.Attempts = viper.GetInt("retry.attempts")
+	c.Retry.Backoff = viper.GetDuration("retry.backoff")
+	c.Retry.MaxBackoff = viper.GetDuration("retry.max_backoff")
+	c.Retry.Jitter = viper.GetFloat64("retry.jitter")
+	if viper.IsSet("retry.status_codes") {
+		c.Retry.StatusCodes = viper.GetIntSlice("retry.status_codes")
+	}
+
+	// Load captcha solver settings
+	c.Captcha.Solver = viper.GetString("captcha.solver")
+	c.Captcha.Command = viper.GetString("captcha.command")
+	c.Captcha.URL = viper.GetString("captcha.url")
+	c.Captcha.Display = viper.GetString("captcha.display")
+	if c.Captcha.Solver == "" {
+		c.Captcha.Solver = "interactive"
+	}
+	if c.Captcha.Display == "" {
+		c.Captcha.Display = "ascii"
+	}
 
 	// Set default service if empty
 	if c.Service == "" {
 		c.Service = "校园网"
 	}
 
-	// Load proxy settings
+	// External password sources are only consulted when the password is needed
+	c.PasswordCommand = viper.GetString("password_command")
+	c.PasswordFile = viper.GetString("password_file")
+
+	// Load missing credentials from the vault, "none" disables it
+	c.VaultFile = viper.GetString("vault")
+	if c.VaultFile == "" {
+		c.VaultFile = DefaultVaultFile()
+	} else if c.VaultFile == "none" {
+		c.VaultFile = ""
+	}
+	c.applyVault()
+
+	// Load proxy settings, ALL_PROXY covers the schemes without a dedicated proxy
+	allProxy := viper.GetString("all_proxy")
 	if httpProxy := viper.GetString("http_proxy"); httpProxy != "" {
 		c.Proxies["http"] = httpProxy
+	} else if allProxy != "" {
+		c.Proxies["http"] = allProxy
 	}
 	if httpsProxy := viper.GetString("https_proxy"); httpsProxy != "" {
 		c.Proxies["https"] = httpsProxy
+	} else if allProxy != "" {
+		c.Proxies["https"] = allProxy
+	}
+	if noProxy := viper.GetString("no_proxy"); noProxy != "" {
+		c.Proxies["no"] = noProxy
 	}
-	if proxy := viper.GetString("proxy"); proxy != "" {
+	c.applyProxy(viper.GetString("proxy"))
+}
+
+// ProxyDirect as proxy setting disables all proxies, including the environment
+const ProxyDirect = "direct"
+
+// applyProxy overrides the per-scheme proxies with a single proxy URL
+func (c *Config) applyProxy(proxy string) {
+	switch proxy {
+	case "":
+	case ProxyDirect:
+		c.Proxies = make(map[string]string)
+	default:
 		c.Proxies["http"] = proxy
 		c.Proxies["https"] = proxy
 	}
@@ -68,18 +206,22 @@ func (c *Config) LoadFromViper() {
 // UpdateFromFlags updates configuration from command line flags
 func (c *Config) UpdateFromFlags(username, password, service, proxy string, verbose bool) {
 	if username != "" {
+		// A vault password belongs to the username it was looked up for
+		if username != c.Username && c.vaultPassword {
+			c.Password = ""
+			c.vaultPassword = false
+		}
 		c.Username = username
 	}
 	if password != "" {
 		c.Password = password
+		c.vaultPassword = false
 	}
+	c.applyVault()
 	if service != "" {
 		c.Service = service
 	}
-	if proxy != "" {
-		c.Proxies["http"] = proxy
-		c.Proxies["https"] = proxy
-	}
+	c.applyProxy(proxy)
 	if verbose {
 		c.Verbose = verbose
 	}
@@ -90,8 +232,24 @@ func (c *Config) ValidateCredentials() bool {
 	return c.Username != "" && c.Password != ""
 }
 
-// GetCredentialsInteractive prompts user for credentials if not provided
+// GetCredentialsInteractive prompts user for credentials if not provided.
+// The password is first taken from the external password sources, or from a
+// vault locked with a passphrase that is unlocked now.
 func (c *Config) GetCredentialsInteractive() error {
+	if c.Password == "" && c.hasPasswordProvider() {
+		if err := c.loadExternalPassword(); err != nil {
+			return err
+		}
+	}
+	if c.Password == "" && errors.Is(c.vaultErr, vault.ErrPassphraseRequired) {
+		if err := c.unlockVault(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+		if c.ValidateCredentials() {
+			return nil
+		}
+	}
+
 	reader := bufio.NewReader(os.Stdin)
 
 	if c.Username == "" {
@@ -104,75 +262,170 @@ func (c *Config) GetCredentialsInteractive() error {
 	}
 
 	if c.Password == "" {
-		fmt.Print("Password: ")
-		bytePassword, err := term.ReadPassword(int(syscall.Stdin))
+		password, err := PromptSecret("Password: ")
 		if err != nil {
 			return fmt.Errorf("failed to read password: %w", err)
 		}
-		fmt.Println() // Print newline after password input
-		c.Password = strings.TrimSpace(string(bytePassword))
+		c.Password = password
 	}
 
 	return nil
 }
 
-// ResolveServiceName resolves service name from aliases
-func (c *Config) ResolveServiceName(serviceInput string) string {
-	if serviceInput == "" {
-		return c.Service
+// PromptSecret reads a line from the terminal without echoing it
+func PromptSecret(prompt string) (string, error) {
+	fmt.Print(prompt)
+	secret, err := term.ReadPassword(int(syscall.Stdin))
+	fmt.Println() // Print newline after password input
+	if err != nil {
+		return "", err
 	}
+	return strings.TrimSpace(string(secret)), nil
+}
 
-	// Direct Chinese service names
-	chineseServices := []string{"校园网", "中国联通", "中国电信", "中国移动"}
-	for _, service := range chineseServices {
-		if serviceInput == service {
-			return serviceInput
+// VaultPassphraseEnv holds the passphrase of a passphrase vault for unattended use
+const VaultPassphraseEnv = "RUIJIE_VAULT_PASSPHRASE"
+
+// applyVault fills in a missing password, and a missing username if the vault
+// holds a single account. A passphrase vault is only opened here when its
+// passphrase is in the environment, otherwise GetCredentialsInteractive asks.
+// Configured external password sources take precedence over the vault.
+func (c *Config) applyVault() {
+	if c.VaultFile == "" || c.Password != "" || c.hasPasswordProvider() {
+		return
+	}
+
+	if c.vault == nil {
+		if c.vaultErr != nil {
+			return
+		}
+		c.vault, c.vaultErr = vault.Open(c.VaultFile, os.Getenv(VaultPassphraseEnv))
+		if c.vaultErr != nil {
+			if !errors.Is(c.vaultErr, fs.ErrNotExist) && !errors.Is(c.vaultErr, vault.ErrPassphraseRequired) {
+				fmt.Fprintf(os.Stderr, "Warning: failed to open %s: %v\n", c.VaultFile, c.vaultErr)
+			}
+			return
 		}
 	}
 
-	// Check mapping
-	if mapped, exists := ServiceMapping[strings.ToLower(serviceInput)]; exists {
-		return mapped
+	if credential, ok := c.vault.Get(c.Username); ok {
+		c.Username = credential.Username
+		c.Password = credential.Password
+		c.vaultPassword = true
 	}
+}
 
-	// Return original input if no mapping found
-	return serviceInput
+// unlockVault asks for the vault passphrase and fills in the credentials
+func (c *Config) unlockVault() error {
+	passphrase, err := PromptSecret("Vault passphrase: ")
+	if err != nil {
+		return fmt.Errorf("failed to read vault passphrase: %w", err)
+	}
+	v, err := vault.Open(c.VaultFile, passphrase)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", c.VaultFile, err)
+	}
+
+	c.vault, c.vaultErr = v, nil
+	c.applyVault()
+	return nil
 }
 
-// GetErrorMessage converts errors to user-friendly messages
-func GetErrorMessage(err error) string {
-	errMsg := strings.ToLower(err.Error())
+// ServiceResolver returns the resolver for the configured service aliases
+func (c *Config) ServiceResolver() *services.Resolver {
+	return services.NewResolver(c.ServiceAliases)
+}
 
-	// Network related errors
-	if strings.Contains(errMsg, "connection") || strings.Contains(errMsg, "timeout") {
-		return "Network connection failed. Please check your internet connection."
+// ServiceCacheKey selects the cached service list of the configured portal and account
+func (c *Config) ServiceCacheKey() string {
+	portalURL := c.Portal.BaseURL
+	if portalURL == "" {
+		portalURL = client.DefaultPortalBaseURL
 	}
+	return services.CacheKey(portalURL, c.Username)
+}
 
-	// Authentication related errors
-	if strings.Contains(errMsg, "authentication failed") || strings.Contains(errMsg, "cas") {
-		return fmt.Sprintf("Authentication failed. Detail: %s", errMsg)
+// CachedServices returns the service list saved by the last visit of the configured portal and account, or nil
+func (c *Config) CachedServices() *models.ServiceList {
+	if c.ServiceCacheFile == "" {
+		return nil
 	}
-
-	// API related errors
-	if strings.Contains(errMsg, "api error") {
-		return fmt.Sprintf("Server error: %s", err.Error())
+	cached, err := services.NewFileCache(c.ServiceCacheFile, c.ServiceCacheKey).Load()
+	if err != nil {
+		return nil
 	}
+	return cached
+}
 
-	// Portal redirection errors
-	if strings.Contains(errMsg, "portal redirection failed") {
-		return "Portal access failed. You may not be connected to the campus network."
+// ResolveServiceName resolves numbers and aliases against the cached service list.
+// Input that cannot be resolved yet is returned unchanged, the client matches
+// it again against the live list during login.
+func (c *Config) ResolveServiceName(serviceInput string) string {
+	if serviceInput == "" {
+		serviceInput = c.Service
 	}
 
-	// CAS redirection errors
-	if strings.Contains(errMsg, "cas redirection failed") {
-		return "CAS authentication failed. Please try again."
+	name, err := c.ServiceResolver().ResolveService(c.CachedServices(), serviceInput)
+	if err != nil {
+		return serviceInput
 	}
+	return name
+}
 
-	// Captcha related errors
-	if strings.Contains(errMsg, "captcha") || strings.Contains(errMsg, "验证码") {
-		return "Captcha verification failed. Please try again."
+// Process exit codes, one per error category
+const (
+	ExitOK                 = 0
+	ExitFailure            = 1
+	ExitNotOnCampus        = 10
+	ExitPortalUnreachable  = 11
+	ExitBadCredentials     = 12
+	ExitAccountLocked      = 13
+	ExitCaptchaRequired    = 14
+	ExitServiceUnavailable = 15
+	ExitAlreadyOnline      = 16
+	ExitUnexpectedSchema   = 17
+	ExitCaptchaUnsolved    = 18
+)
+
+// errorCategories lists the client error categories in order of precedence,
+// with their user-facing hint and exit code
+var errorCategories = []struct {
+	err      error
+	hint     string
+	exitCode int
+}{
+	{client.ErrCaptchaUnsolved, "The captcha could not be solved. Please check the captcha solver or log in once in a browser.", ExitCaptchaUnsolved},
+	{client.ErrCaptchaRequired, "Captcha verification required. Please log in once in a browser or configure a captcha solver.", ExitCaptchaRequired},
+	{client.ErrAccountLocked, "The account is locked. Please wait or contact the network center.", ExitAccountLocked},
+	{client.ErrBadCredentials, "Authentication failed. Please check your username and password.", ExitBadCredentials},
+	{client.ErrAlreadyOnline, "The account is already online on another device. Log it out first.", ExitAlreadyOnline},
+	{client.ErrServiceUnavailable, "The selected service is not available for this account.", ExitServiceUnavailable},
+	{client.ErrNotOnCampus, "Portal access failed. You may not be connected to the campus network, run 'ruijie-go doctor' to find out.", ExitNotOnCampus},
+	{client.ErrPortalUnreachable, "Network connection failed. The portal could not be reached, run 'ruijie-go doctor' to find out why.", ExitPortalUnreachable},
+	{client.ErrUnexpectedSchema, "The portal returned an unexpected response. It may have been changed.", ExitUnexpectedSchema},
+}
+
+// GetErrorMessage converts errors to user-friendly messages
+func GetErrorMessage(err error) string {
+	for _, category := range errorCategories {
+		if errors.Is(err, category.err) {
+			return fmt.Sprintf("%s Detail: %s", category.hint, err.Error())
+		}
 	}
 
 	// Default error message
 	return fmt.Sprintf("Operation failed: %s", err.Error())
 }
+
+// ExitCode returns the process exit code for an error
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	for _, category := range errorCategories {
+		if errors.Is(err, category.err) {
+			return category.exitCode
+		}
+	}
+	return ExitFailure
+}
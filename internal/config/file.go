@@ -0,0 +1,190 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileValue is a dotted key of a config file with its value
+type FileValue struct {
+	Key   string
+	Value interface{}
+}
+
+// SetFileValue sets a dotted key such as portal.base_url in a YAML config file,
+// keeping the comments and order of the other entries. The file is created
+// with 0600 permissions if it does not exist. A nil value removes the key.
+func SetFileValue(path, key string, value interface{}) error {
+	// Writing YAML would break a legacy ~/.ruijie-go.json or .toml
+	if ext := filepath.Ext(path); ext == ".json" || ext == ".toml" {
+		return notYAMLError(path)
+	}
+
+	doc, err := readYAMLFile(path)
+	if err != nil {
+		return err
+	}
+	if err := setNodeValue(doc, key, value); err != nil {
+		return fmt.Errorf("%w in %s", err, path)
+	}
+
+	return writeYAMLFile(path, doc)
+}
+
+// WriteFileValues replaces a YAML config file with one holding values in
+// order. The old file stays in place until the new one is complete.
+func WriteFileValues(path string, values []FileValue) error {
+	if ext := filepath.Ext(path); ext == ".json" || ext == ".toml" {
+		return notYAMLError(path)
+	}
+
+	doc := newYAMLDocument()
+	for _, value := range values {
+		if err := setNodeValue(doc, value.Key, value.Value); err != nil {
+			return err
+		}
+	}
+
+	return writeYAMLFile(path, doc)
+}
+
+// setNodeValue sets a dotted key in a document node, a nil value removes it
+func setNodeValue(doc *yaml.Node, key string, value interface{}) error {
+	root := doc.Content[0]
+	parts := strings.Split(key, ".")
+	for _, part := range parts[:len(parts)-1] {
+		child := mappingValue(root, part)
+		if child == nil {
+			if value == nil {
+				return nil
+			}
+			child = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: part}, child)
+		}
+		if child.Kind != yaml.MappingNode {
+			return fmt.Errorf("%s is not a section", part)
+		}
+		root = child
+	}
+
+	last := parts[len(parts)-1]
+	if value == nil {
+		removeMappingKey(root, last)
+		return nil
+	}
+
+	var node yaml.Node
+	if err := node.Encode(value); err != nil {
+		return fmt.Errorf("failed to encode %s: %w", key, err)
+	}
+	if existing := mappingValue(root, last); existing != nil {
+		// Keep the comments attached to the old value
+		node.HeadComment, node.LineComment, node.FootComment = existing.HeadComment, existing.LineComment, existing.FootComment
+		*existing = node
+	} else {
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: last}, &node)
+	}
+	return nil
+}
+
+// notYAMLError reports a config file in a format only viper reads
+func notYAMLError(path string) error {
+	return fmt.Errorf("%s is not a YAML file, convert it to YAML and save it as %s first", path, inDir(ConfigDir(), "config.yaml"))
+}
+
+// newYAMLDocument returns a document node holding an empty mapping
+func newYAMLDocument() *yaml.Node {
+	return &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+}
+
+// readYAMLFile parses a YAML file into a document node, a missing or empty file yields an empty mapping
+func readYAMLFile(path string) (*yaml.Node, error) {
+	doc := newYAMLDocument()
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return doc, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var parsed yaml.Node
+	if err := yaml.Unmarshal(data, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	if len(parsed.Content) == 0 {
+		return doc, nil
+	}
+	if parsed.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("config file %s is not a YAML mapping", path)
+	}
+	return &parsed, nil
+}
+
+// writeYAMLFile atomically replaces a file with a document node, with 0600 permissions
+func writeYAMLFile(path string, doc *yaml.Node) error {
+	var buf strings.Builder
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(doc); err != nil {
+		return fmt.Errorf("failed to encode config file: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return fmt.Errorf("failed to encode config file: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	// The file may hold a password, so the new one never exists with a wider mode
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".config-*")
+	if err != nil {
+		return fmt.Errorf("failed to create config file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to restrict config file permissions: %w", err)
+	}
+	if _, err := tmp.WriteString(buf.String()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	return nil
+}
+
+// mappingValue returns the value of key in a mapping node, nil if absent
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// removeMappingKey deletes key and its value from a mapping node
+func removeMappingKey(mapping *yaml.Node, key string) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+			return
+		}
+	}
+}
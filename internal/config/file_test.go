@@ -0,0 +1,181 @@
+package config
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// commentedConfig is a hand-written config file
+const commentedConfig = `# Campus network login
+username: alice # student number
+# Telecom at home
+service: dx
+
+portal:
+  # Test portal
+  base_url: http://127.0.0.1:8080
+retry:
+  attempts: 3
+`
+
+// writeConfig writes content to a new config file
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// readConfig returns the content of a config file and checks its mode
+func readConfig(t *testing.T, path string) string {
+	t.Helper()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("config file mode = %o, want 600", mode)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestSetFileValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		key   string
+		value interface{}
+		want  string
+	}{
+		{"replace", "service", "中国移动", `# Campus network login
+username: alice # student number
+# Telecom at home
+service: 中国移动
+portal:
+  # Test portal
+  base_url: http://127.0.0.1:8080
+retry:
+  attempts: 3
+`},
+		{"nested", "retry.backoff", "1s", `# Campus network login
+username: alice # student number
+# Telecom at home
+service: dx
+portal:
+  # Test portal
+  base_url: http://127.0.0.1:8080
+retry:
+  attempts: 3
+  backoff: 1s
+`},
+		{"new section", "captcha.solver", "none", `# Campus network login
+username: alice # student number
+# Telecom at home
+service: dx
+portal:
+  # Test portal
+  base_url: http://127.0.0.1:8080
+retry:
+  attempts: 3
+captcha:
+  solver: none
+`},
+		{"remove", "portal.base_url", nil, `# Campus network login
+username: alice # student number
+# Telecom at home
+service: dx
+portal: {}
+retry:
+  attempts: 3
+`},
+		{"remove missing", "captcha.solver", nil, `# Campus network login
+username: alice # student number
+# Telecom at home
+service: dx
+portal:
+  # Test portal
+  base_url: http://127.0.0.1:8080
+retry:
+  attempts: 3
+`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfig(t, commentedConfig)
+			if err := SetFileValue(path, tt.key, tt.value); err != nil {
+				t.Fatalf("SetFileValue: %v", err)
+			}
+			if got := readConfig(t, path); got != tt.want {
+				t.Errorf("config file =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetFileValueErrors(t *testing.T) {
+	path := writeConfig(t, commentedConfig)
+	if err := SetFileValue(path, "username.first", "alice"); err == nil || !strings.Contains(err.Error(), "not a section") {
+		t.Errorf("setting a key below a value = %v, want an error", err)
+	}
+
+	for _, name := range []string{".ruijie-go.json", ".ruijie-go.toml"} {
+		path := filepath.Join(t.TempDir(), name)
+		if err := SetFileValue(path, "username", "alice"); err == nil {
+			t.Errorf("SetFileValue(%s) succeeded", name)
+		}
+		if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("SetFileValue(%s) created the file", name)
+		}
+	}
+}
+
+func TestWriteFileValues(t *testing.T) {
+	path := writeConfig(t, commentedConfig)
+	values := []FileValue{
+		{Key: "username", Value: "bob"},
+		{Key: "portal.base_url", Value: "http://portal"},
+		{Key: "service", Value: "校园网"},
+	}
+	if err := WriteFileValues(path, values); err != nil {
+		t.Fatalf("WriteFileValues: %v", err)
+	}
+
+	want := "username: bob\nportal:\n  base_url: http://portal\nservice: 校园网\n"
+	if got := readConfig(t, path); got != want {
+		t.Errorf("config file =\n%s\nwant\n%s", got, want)
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(filepath.Dir(path), ".config-*")); len(leftovers) != 0 {
+		t.Errorf("temporary files left behind: %v", leftovers)
+	}
+}
+
+func TestWriteFileValuesKeepsOldFileOnError(t *testing.T) {
+	path := writeConfig(t, commentedConfig)
+	values := []FileValue{
+		{Key: "username", Value: "bob"},
+		{Key: "username.first", Value: "bob"},
+	}
+	if err := WriteFileValues(path, values); err == nil {
+		t.Fatal("WriteFileValues with a conflicting key succeeded")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != commentedConfig {
+		t.Errorf("config file after a failed write =\n%s\nwant the old one", data)
+	}
+}
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// SystemdPasswordCredential is the name of the systemd credential holding the
+// password, e.g. LoadCredential=password:/etc/ruijie-go/password
+const SystemdPasswordCredential = "password"
+
+// hasPasswordProvider reports whether an external password source is configured
+func (c *Config) hasPasswordProvider() bool {
+	return c.PasswordCommand != "" || c.PasswordFile != "" || systemdCredential() != ""
+}
+
+// loadExternalPassword reads the password from password_command, password_file
+// or the systemd credentials, the first one configured wins
+func (c *Config) loadExternalPassword() error {
+	var err error
+	switch {
+	case c.PasswordCommand != "":
+		c.Password, err = c.runPasswordCommand()
+	case c.PasswordFile != "":
+		c.Password, err = readPasswordFile(c.PasswordFile)
+	case systemdCredential() != "":
+		c.Password, err = readPasswordFile(systemdCredential())
+	}
+	return err
+}
+
+// runPasswordCommand runs password_command and returns the first line of its
+// output. The command is split at spaces without a shell, so quotes do not
+// group arguments; pipes and quoting belong in a script. The command gets
+// the username in RUIJIE_USERNAME.
+func (c *Config) runPasswordCommand() (string, error) {
+	args := strings.Fields(c.PasswordCommand)
+	if len(args) == 0 {
+		return "", errors.New("password command is empty")
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Env = append(os.Environ(), "RUIJIE_USERNAME="+c.Username)
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("password command failed: %w", err)
+	}
+
+	password, _, _ := strings.Cut(string(output), "\n")
+	password = strings.TrimRight(password, "\r")
+	if password == "" {
+		return "", errors.New("password command returned no password")
+	}
+	return password, nil
+}
+
+// systemdCredential returns the path of the password credential passed by
+// systemd in $CREDENTIALS_DIRECTORY, empty if there is none
+func systemdCredential() string {
+	dir := os.Getenv("CREDENTIALS_DIRECTORY")
+	if dir == "" {
+		return ""
+	}
+	path := filepath.Join(dir, SystemdPasswordCredential)
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+// readPasswordFile returns the first line of a secret file
+func readPasswordFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read password file: %w", err)
+	}
+	defer file.Close()
+
+	password, err := readPasswordLine(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read password file %s: %w", path, err)
+	}
+	return password, nil
+}
+
+// ReadPasswordStdin returns the first line of stdin, for --password-stdin
+func ReadPasswordStdin() (string, error) {
+	password, err := readPasswordLine(os.Stdin)
+	if err != nil {
+		return "", fmt.Errorf("failed to read password from stdin: %w", err)
+	}
+	return password, nil
+}
+
+// readPasswordLine reads the first line of r without its line break
+func readPasswordLine(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", errors.New("password is empty")
+	}
+	return password, nil
+}
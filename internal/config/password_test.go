@@ -0,0 +1,182 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeSecret writes content to a new file in dir with the given mode
+func writeSecret(t *testing.T, dir, name, content string, mode os.FileMode) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), mode); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRunPasswordCommand(t *testing.T) {
+	tests := []struct {
+		command string
+		want    string // Empty when an error is expected
+		err     string // Part of the expected error
+	}{
+		{command: "echo hunter2", want: "hunter2"},
+		{command: `printf hunter2\r\nsecond\n`, want: "hunter2"},
+		{command: `printf \040hunter\0402\040`, want: " hunter 2 "},
+		{command: "printenv RUIJIE_USERNAME", want: "alice"},
+		{command: "true", err: "returned no password"},
+		{command: "echo", err: "returned no password"},
+		{command: "false", err: "password command failed"},
+		{command: "/nonexistent/password-helper", err: "password command failed"},
+		{command: "   ", err: "password command is empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			cfg := &Config{Username: "alice", PasswordCommand: tt.command}
+			got, err := cfg.runPasswordCommand()
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("runPasswordCommand() = %q, %v, want an error containing %q", got, err, tt.err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("runPasswordCommand() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadPasswordFile(t *testing.T) {
+	tests := []struct {
+		name, content string
+		want          string // Empty when an error is expected
+	}{
+		{"line", "hunter2\n", "hunter2"},
+		{"no line break", "hunter2", "hunter2"},
+		{"crlf and more lines", "hunter2\r\nsecond\n", "hunter2"},
+		{"spaces kept", " hunter 2 \n", " hunter 2 "},
+		{"empty line", "\nhunter2\n", ""},
+		{"empty file", "", ""},
+	}
+
+	dir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeSecret(t, dir, tt.name, tt.content, 0600)
+			got, err := readPasswordFile(path)
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("readPasswordFile(%q) = %q, want an error", tt.content, got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("readPasswordFile(%q) = %q, %v, want %q", tt.content, got, err, tt.want)
+			}
+		})
+	}
+
+	if _, err := readPasswordFile(filepath.Join(dir, "missing")); err == nil {
+		t.Error("readPasswordFile of a missing file succeeded")
+	}
+	if _, err := readPasswordFile(dir); err == nil {
+		t.Error("readPasswordFile of a directory succeeded")
+	}
+}
+
+func TestReadPasswordFilePermissions(t *testing.T) {
+	dir := t.TempDir()
+
+	// Read-only secrets such as Docker secrets are fine
+	if got, err := readPasswordFile(writeSecret(t, dir, "secret", "hunter2\n", 0400)); err != nil || got != "hunter2" {
+		t.Errorf("readPasswordFile of a read-only file = %q, %v, want the password", got, err)
+	}
+
+	if os.Geteuid() == 0 {
+		t.Skip("root reads files without read permission")
+	}
+	if _, err := readPasswordFile(writeSecret(t, dir, "locked", "hunter2\n", 0000)); err == nil {
+		t.Error("readPasswordFile of a file without read permission succeeded")
+	}
+}
+
+func TestReadPasswordStdin(t *testing.T) {
+	stdin := os.Stdin
+	t.Cleanup(func() { os.Stdin = stdin })
+
+	for content, want := range map[string]string{"hunter2\nsecond\n": "hunter2", "hunter2\r\n": "hunter2", "\n": ""} {
+		file, err := os.Open(writeSecret(t, t.TempDir(), "stdin", content, 0600))
+		if err != nil {
+			t.Fatal(err)
+		}
+		os.Stdin = file
+
+		got, err := ReadPasswordStdin()
+		file.Close()
+		if want == "" && err == nil {
+			t.Errorf("ReadPasswordStdin with %q = %q, want an error", content, got)
+		}
+		if want != "" && (err != nil || got != want) {
+			t.Errorf("ReadPasswordStdin with %q = %q, %v, want %q", content, got, err, want)
+		}
+	}
+}
+
+func TestPasswordSourcePrecedence(t *testing.T) {
+	credentials := t.TempDir()
+	writeSecret(t, credentials, SystemdPasswordCredential, "from-systemd\n", 0400)
+	file := writeSecret(t, t.TempDir(), "password", "from-file\n", 0600)
+
+	tests := []struct {
+		name        string
+		cfg         Config
+		credentials string // $CREDENTIALS_DIRECTORY
+		want        string
+	}{
+		{"flag over command", Config{Password: "from-flag", PasswordCommand: "false"}, credentials, "from-flag"},
+		{"command over file", Config{PasswordCommand: "echo from-command", PasswordFile: file}, credentials, "from-command"},
+		{"file over systemd", Config{PasswordFile: file}, credentials, "from-file"},
+		{"systemd", Config{}, credentials, "from-systemd"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CREDENTIALS_DIRECTORY", tt.credentials)
+			cfg := tt.cfg
+			cfg.Username = "alice"
+
+			if err := cfg.GetCredentialsInteractive(); err != nil {
+				t.Fatalf("GetCredentialsInteractive: %v", err)
+			}
+			if cfg.Password != tt.want {
+				t.Errorf("password = %q, want %q", cfg.Password, tt.want)
+			}
+		})
+	}
+
+	// Other systemd credentials are no password source
+	t.Setenv("CREDENTIALS_DIRECTORY", t.TempDir())
+	if (&Config{}).hasPasswordProvider() {
+		t.Error("a credentials directory without the password credential counts as a password source")
+	}
+}
+
+func TestPasswordSourceFailure(t *testing.T) {
+	t.Setenv("CREDENTIALS_DIRECTORY", "")
+
+	// A configured source that fails is reported, not replaced by a prompt
+	for _, cfg := range []Config{
+		{Username: "alice", PasswordCommand: "false"},
+		{Username: "alice", PasswordFile: filepath.Join(t.TempDir(), "missing")},
+	} {
+		if err := cfg.GetCredentialsInteractive(); err == nil {
+			t.Errorf("GetCredentialsInteractive with %+v succeeded", cfg)
+		}
+	}
+}
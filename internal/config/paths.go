@@ -0,0 +1,167 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// appName names the directories of ruijie-go below the XDG base directories
+const appName = "ruijie-go"
+
+// legacyConfigName is the config file kept in the home directory before the
+// XDG layout, still read with any extension viper supports
+const legacyConfigName = ".ruijie-go"
+
+// legacyConfigExts are the extensions viper found the legacy config file with
+var legacyConfigExts = []string{".yaml", ".yml", ".json", ".toml"}
+
+// ConfigDir returns $XDG_CONFIG_HOME/ruijie-go, holding the config file and the vault
+func ConfigDir() string {
+	return xdgDir("XDG_CONFIG_HOME", ".config", os.UserConfigDir)
+}
+
+// StateDir returns $XDG_STATE_HOME/ruijie-go, holding the saved portal session
+func StateDir() string {
+	return xdgDir("XDG_STATE_HOME", filepath.Join(".local", "state"), nil)
+}
+
+// CacheDir returns $XDG_CACHE_HOME/ruijie-go, holding data that can be fetched again
+func CacheDir() string {
+	return xdgDir("XDG_CACHE_HOME", ".cache", os.UserCacheDir)
+}
+
+// RuntimeDir returns $XDG_RUNTIME_DIR/ruijie-go, holding sockets, locks and
+// other files that must not outlive the login session. Without a runtime
+// directory a per-user directory in the system temp directory is used, create
+// it with MakeRuntimeDir.
+func RuntimeDir() string {
+	if base := os.Getenv("XDG_RUNTIME_DIR"); filepath.IsAbs(base) {
+		return filepath.Join(base, appName)
+	}
+	return filepath.Join(os.TempDir(), tempRuntimeDirName())
+}
+
+// MakeRuntimeDir creates RuntimeDir with 0700 permissions and returns it.
+// Other users may create the directory in a shared temp directory first, so an
+// existing one is only accepted if it is a real directory that only we can use.
+func MakeRuntimeDir() (string, error) {
+	dir := RuntimeDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create runtime directory: %w", err)
+	}
+
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to check runtime directory: %w", err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("runtime directory %s is not a directory", dir)
+	}
+	if err := checkPrivateDir(info); err != nil {
+		return "", fmt.Errorf("runtime directory %s is unsafe: %w", dir, err)
+	}
+	return dir, nil
+}
+
+// errNotPrivate reports a directory that other users can read or write
+var errNotPrivate = errors.New("it is accessible by other users, expected mode 0700")
+
+// xdgDir returns the ruijie-go directory below the base directory in env,
+// else below the platform default from fallback or homeDir in the home
+// directory. The spec requires absolute paths, so a relative one falls back
+// like an unset one.
+func xdgDir(env, homeDir string, fallback func() (string, error)) string {
+	if base := os.Getenv(env); filepath.IsAbs(base) {
+		return filepath.Join(base, appName)
+	}
+
+	// os.UserConfigDir fails on a relative variable instead of ignoring it
+	if fallback != nil {
+		if base, err := fallback(); err == nil {
+			return filepath.Join(base, appName)
+		}
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, homeDir, appName)
+}
+
+// DefaultConfigFile returns the config file read when --config is not given:
+// config.yaml in ConfigDir, or ~/.ruijie-go.yaml (.yml, .json, .toml) while
+// only that one exists
+func DefaultConfigFile() string {
+	return preferExisting(inDir(ConfigDir(), "config.yaml"), legacyConfigFile())
+}
+
+// DefaultStateFile returns the default location of the saved portal session
+func DefaultStateFile() string {
+	return inDir(StateDir(), "session.json")
+}
+
+// DefaultServiceCacheFile returns the default location of the cached service list
+func DefaultServiceCacheFile() string {
+	return inDir(CacheDir(), "services.json")
+}
+
+// DefaultVaultFile returns the default location of the encrypted credential vault
+func DefaultVaultFile() string {
+	return inDir(ConfigDir(), "credentials.vault")
+}
+
+// MigrationHint returns the command moving a config file still in the home
+// directory to the XDG layout, empty if there is nothing to move
+func MigrationHint() string {
+	legacy, current := legacyConfigFile(), inDir(ConfigDir(), "config.yaml")
+	if legacy == "" || current == "" || preferExisting(current, legacy) != legacy {
+		return ""
+	}
+
+	if filepath.Ext(legacy) == ".toml" {
+		// config.yaml is read as YAML, which JSON already is but TOML is not
+		return fmt.Sprintf("%s is deprecated, convert it to YAML and save it as %s", legacy, current)
+	}
+	return fmt.Sprintf("%s is deprecated, move it with:\n  mkdir -p %s && mv %s %s", legacy, filepath.Dir(current), legacy, current)
+}
+
+// inDir joins dir and name, empty if the directory is unknown
+func inDir(dir, name string) string {
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, name)
+}
+
+// legacyConfigFile returns the config file in the home directory with the
+// first extension that exists, ~/.ruijie-go.yaml if none does and empty if
+// there is no home
+func legacyConfigFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	for _, ext := range legacyConfigExts {
+		path := filepath.Join(home, legacyConfigName+ext)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return filepath.Join(home, legacyConfigName+legacyConfigExts[0])
+}
+
+// preferExisting returns legacy if only it exists, so old setups keep working
+func preferExisting(current, legacy string) string {
+	if legacy == "" || current == "" {
+		return current
+	}
+	if _, err := os.Stat(current); err == nil {
+		return current
+	}
+	if _, err := os.Stat(legacy); err == nil {
+		return legacy
+	}
+	return current
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package config
+
+import "io/fs"
+
+// tempRuntimeDirName names the runtime directory in the temp directory, which
+// is per user on Windows, where there is no uid to tell users apart
+func tempRuntimeDirName() string {
+	return appName
+}
+
+// checkPrivateDir accepts any directory, the temp directory is already private
+func checkPrivateDir(info fs.FileInfo) error {
+	return nil
+}
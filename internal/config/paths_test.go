@@ -0,0 +1,160 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// setHome points the home directory at a new directory, which it returns, and
+// sets all XDG variables to xdg
+func setHome(t *testing.T, xdg string) string {
+	t.Helper()
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	for _, env := range []string{"XDG_CONFIG_HOME", "XDG_STATE_HOME", "XDG_CACHE_HOME", "XDG_RUNTIME_DIR"} {
+		t.Setenv(env, xdg)
+	}
+	return home
+}
+
+func TestXDGDirs(t *testing.T) {
+	base := t.TempDir()
+	setHome(t, "")
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(base, "config"))
+	t.Setenv("XDG_STATE_HOME", filepath.Join(base, "state"))
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(base, "cache"))
+	t.Setenv("XDG_RUNTIME_DIR", filepath.Join(base, "run"))
+
+	for _, test := range []struct{ name, got, want string }{
+		{"config", ConfigDir(), filepath.Join(base, "config", appName)},
+		{"state", StateDir(), filepath.Join(base, "state", appName)},
+		{"cache", CacheDir(), filepath.Join(base, "cache", appName)},
+		{"runtime", RuntimeDir(), filepath.Join(base, "run", appName)},
+		{"session", DefaultStateFile(), filepath.Join(base, "state", appName, "session.json")},
+		{"vault", DefaultVaultFile(), filepath.Join(base, "config", appName, "credentials.vault")},
+		{"service cache", DefaultServiceCacheFile(), filepath.Join(base, "cache", appName, "services.json")},
+	} {
+		if test.got != test.want {
+			t.Errorf("%s = %q, want %q", test.name, test.got, test.want)
+		}
+	}
+}
+
+func TestXDGDefaults(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the platform defaults of os.UserConfigDir differ")
+	}
+
+	// Relative paths are not allowed by the spec and ignored like unset variables
+	for _, xdg := range []string{"", "relative/dir"} {
+		home := setHome(t, xdg)
+
+		for _, test := range []struct{ name, got, want string }{
+			{"config", ConfigDir(), filepath.Join(home, ".config", appName)},
+			{"state", StateDir(), filepath.Join(home, ".local", "state", appName)},
+			{"cache", CacheDir(), filepath.Join(home, ".cache", appName)},
+			{"runtime", RuntimeDir(), filepath.Join(os.TempDir(), tempRuntimeDirName())},
+		} {
+			if test.got != test.want {
+				t.Errorf("%s with XDG variables %q = %q, want %q", test.name, xdg, test.got, test.want)
+			}
+		}
+	}
+}
+
+func TestLegacyConfigFile(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string // Created below the home directory
+		want  string   // Config file below the home directory
+		hint  string   // Part of the migration hint, empty for none
+	}{
+		{"none", nil, ".config/ruijie-go/config.yaml", ""},
+		{"current", []string{".config/ruijie-go/config.yaml", ".ruijie-go.yaml"}, ".config/ruijie-go/config.yaml", ""},
+		{"legacy yaml", []string{".ruijie-go.yaml"}, ".ruijie-go.yaml", "move it with"},
+		{"legacy json", []string{".ruijie-go.json"}, ".ruijie-go.json", "move it with"},
+		{"legacy toml", []string{".ruijie-go.toml"}, ".ruijie-go.toml", "convert it to YAML"},
+		{"yaml before yml", []string{".ruijie-go.yml", ".ruijie-go.yaml"}, ".ruijie-go.yaml", "move it with"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			home := setHome(t, "")
+			t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+			for _, file := range tt.files {
+				path := filepath.Join(home, file)
+				if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte("username: alice\n"), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if got, want := DefaultConfigFile(), filepath.Join(home, tt.want); got != want {
+				t.Errorf("DefaultConfigFile() = %q, want %q", got, want)
+			}
+			hint := MigrationHint()
+			if tt.hint == "" && hint != "" || !strings.Contains(hint, tt.hint) {
+				t.Errorf("MigrationHint() = %q, want %q", hint, tt.hint)
+			}
+		})
+	}
+}
+
+func TestMakeRuntimeDir(t *testing.T) {
+	base := t.TempDir()
+	t.Setenv("XDG_RUNTIME_DIR", base)
+
+	dir, err := MakeRuntimeDir()
+	if err != nil {
+		t.Fatalf("MakeRuntimeDir: %v", err)
+	}
+	if want := filepath.Join(base, appName); dir != want {
+		t.Errorf("MakeRuntimeDir() = %q, want %q", dir, want)
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.IsDir() || runtime.GOOS != "windows" && info.Mode().Perm() != 0700 {
+		t.Errorf("runtime directory mode = %v, want a directory with mode 700", info.Mode())
+	}
+
+	// An existing directory is reused
+	if again, err := MakeRuntimeDir(); err != nil || again != dir {
+		t.Errorf("MakeRuntimeDir() again = %q, %v, want %q", again, err, dir)
+	}
+}
+
+func TestMakeRuntimeDirRejectsNonDirectories(t *testing.T) {
+	tests := map[string]func(path string) error{
+		"file": func(path string) error {
+			return os.WriteFile(path, nil, 0600)
+		},
+		"symlink": func(path string) error {
+			target := filepath.Join(filepath.Dir(path), "target")
+			if err := os.Mkdir(target, 0700); err != nil {
+				return err
+			}
+			return os.Symlink(target, path)
+		},
+	}
+
+	for name, create := range tests {
+		t.Run(name, func(t *testing.T) {
+			base := t.TempDir()
+			t.Setenv("XDG_RUNTIME_DIR", base)
+			if err := create(filepath.Join(base, appName)); err != nil {
+				t.Skip(err)
+			}
+			if dir, err := MakeRuntimeDir(); err == nil {
+				t.Errorf("MakeRuntimeDir() over a %s = %q, want an error", name, dir)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+//go:build unix
+
+package config
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// tempRuntimeDirName names the runtime directory in the shared temp directory after our uid
+func tempRuntimeDirName() string {
+	return fmt.Sprintf("%s-%d", appName, os.Getuid())
+}
+
+// checkPrivateDir checks that a directory belongs to us and is closed to other users
+func checkPrivateDir(info fs.FileInfo) error {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && int(stat.Uid) != os.Getuid() {
+		return fmt.Errorf("it is owned by uid %d", stat.Uid)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return errNotPrivate
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+//go:build unix
+
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestMakeRuntimeDirRejectsSharedDir(t *testing.T) {
+	for _, mode := range []os.FileMode{0755, 0770, 0707, 0711} {
+		base := t.TempDir()
+		t.Setenv("XDG_RUNTIME_DIR", base)
+		dir := filepath.Join(base, appName)
+		if err := os.Mkdir(dir, 0700); err != nil {
+			t.Fatal(err)
+		}
+		// Chmod is not subject to the umask
+		if err := os.Chmod(dir, mode); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := MakeRuntimeDir(); !errors.Is(err, errNotPrivate) {
+			t.Errorf("MakeRuntimeDir() over a directory with mode %o = %v, want errNotPrivate", mode, err)
+		}
+	}
+}
+
+func TestMakeRuntimeDirRejectsOtherOwner(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("only root can give a directory to another user")
+	}
+
+	base := t.TempDir()
+	t.Setenv("XDG_RUNTIME_DIR", base)
+	dir := filepath.Join(base, appName)
+	if err := os.Mkdir(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chown(dir, 4242, -1); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := MakeRuntimeDir(); err == nil || !strings.Contains(err.Error(), "owned by uid 4242") {
+		t.Errorf("MakeRuntimeDir() over a directory of another user = %v, want an error", err)
+	}
+}
+
+func TestTempRuntimeDirPerUser(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", "")
+
+	if got, want := RuntimeDir(), filepath.Join(os.TempDir(), "ruijie-go-"+strconv.Itoa(os.Getuid())); got != want {
+		t.Errorf("RuntimeDir() without XDG_RUNTIME_DIR = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// credentialKeys are replaced as a group by a profile, so a password of the
+// base config never pairs with the username of a profile
+var credentialKeys = []string{"username", "password", "password_command", "password_file"}
+
+// Profile is a named set of settings in the profiles section of the config file
+type Profile struct {
+	Name     string
+	Username string
+	Service  string
+}
+
+// Profiles lists the profiles of the config file sorted by name
+func Profiles() []Profile {
+	var profiles []Profile
+	for name, value := range viper.GetStringMap("profiles") {
+		settings, _ := value.(map[string]interface{})
+		profiles = append(profiles, Profile{
+			Name:     name,
+			Username: stringSetting(settings, "username"),
+			Service:  stringSetting(settings, "service"),
+		})
+	}
+	sort.Slice(profiles, func(i, j int) bool {
+		return profiles[i].Name < profiles[j].Name
+	})
+	return profiles
+}
+
+// ApplyProfile merges the settings of the profile selected with --profile,
+// RUIJIE_PROFILE or the profile key over the config file. Environment
+// variables and flags still take precedence over the profile.
+func ApplyProfile() error {
+	name := strings.ToLower(viper.GetString("profile"))
+	if name == "" {
+		return nil
+	}
+
+	value, ok := viper.GetStringMap("profiles")[name]
+	if !ok {
+		var names []string
+		for _, profile := range Profiles() {
+			names = append(names, profile.Name)
+		}
+		if len(names) == 0 {
+			return fmt.Errorf("unknown profile %q, the config file defines no profiles", name)
+		}
+		return fmt.Errorf("unknown profile %q (available: %s)", name, strings.Join(names, ", "))
+	}
+	settings, ok := value.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("profile %q is not a section of settings", name)
+	}
+
+	merged := make(map[string]interface{}, len(settings))
+	for key, value := range settings {
+		if key != "profile" && key != "profiles" {
+			merged[key] = value
+		}
+	}
+	if slices.ContainsFunc(credentialKeys, func(key string) bool { return settings[key] != nil }) {
+		for _, key := range credentialKeys {
+			if settings[key] == nil {
+				merged[key] = ""
+			}
+		}
+	}
+
+	return viper.MergeConfigMap(merged)
+}
+
+// stringSetting returns a setting of a profile as string, empty if absent
+func stringSetting(settings map[string]interface{}, key string) string {
+	if value, ok := settings[key]; ok && value != nil {
+		return fmt.Sprint(value)
+	}
+	return ""
+}
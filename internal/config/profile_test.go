@@ -0,0 +1,162 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// profileConfig is a config file with a base account and two profiles
+const profileConfig = `
+username: alice
+password: alice-secret
+password_command: pass show alice
+service: 校园网
+timeout: 30s
+retry:
+  attempts: 3
+  backoff: 1s
+profiles:
+  lab:
+    username: lab-shared
+    password_file: /run/secrets/lab
+    service: 中国移动
+    retry:
+      attempts: 5
+  home:
+    service: 中国电信
+  broken: 中国联通
+`
+
+// loadConfig resets viper to content read like initConfig does, the returned
+// flags are bound to their keys like the root command flags
+func loadConfig(t *testing.T, content string) *pflag.FlagSet {
+	t.Helper()
+
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	viper.SetEnvPrefix("RUIJIE")
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	viper.AutomaticEnv()
+	viper.SetConfigType("yaml")
+	if err := viper.ReadConfig(strings.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.String("profile", "", "")
+	flags.String("service", "", "")
+	viper.BindPFlag("profile", flags.Lookup("profile"))
+	viper.BindPFlag("service", flags.Lookup("service"))
+	return flags
+}
+
+func TestApplyProfile(t *testing.T) {
+	tests := []struct {
+		name  string
+		flags []string          // Command line
+		env   map[string]string // Environment
+		want  map[string]string // Expected settings after applying the profile
+	}{
+		{
+			name: "no profile",
+			want: map[string]string{"username": "alice", "password": "alice-secret", "service": "校园网"},
+		},
+		{
+			name:  "profile over base",
+			flags: []string{"--profile", "lab"},
+			want: map[string]string{
+				"username": "lab-shared", "password_file": "/run/secrets/lab", "service": "中国移动",
+				"timeout": "30s", "retry.attempts": "5", "retry.backoff": "1s",
+			},
+		},
+		{
+			name:  "credentials replaced as a group",
+			flags: []string{"--profile", "lab"},
+			want:  map[string]string{"password": "", "password_command": ""},
+		},
+		{
+			name:  "base credentials kept without profile credentials",
+			flags: []string{"--profile", "home"},
+			want:  map[string]string{"username": "alice", "password": "alice-secret", "password_command": "pass show alice", "service": "中国电信"},
+		},
+		{
+			name:  "flag over profile",
+			flags: []string{"--profile", "lab", "--service", "中国联通"},
+			want:  map[string]string{"service": "中国联通", "username": "lab-shared"},
+		},
+		{
+			name:  "environment over profile",
+			flags: []string{"--profile", "lab"},
+			env:   map[string]string{"RUIJIE_SERVICE": "中国联通", "RUIJIE_RETRY_ATTEMPTS": "2", "RUIJIE_PASSWORD": "from-env"},
+			want:  map[string]string{"service": "中国联通", "retry.attempts": "2", "password": "from-env"},
+		},
+		{
+			name: "profile from the environment",
+			env:  map[string]string{"RUIJIE_PROFILE": "LAB"},
+			want: map[string]string{"username": "lab-shared"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			flags := loadConfig(t, profileConfig)
+			if err := flags.Parse(tt.flags); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := ApplyProfile(); err != nil {
+				t.Fatalf("ApplyProfile: %v", err)
+			}
+			for key, want := range tt.want {
+				if got := viper.GetString(key); got != want {
+					t.Errorf("%s = %q, want %q", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyProfileFromConfigFile(t *testing.T) {
+	loadConfig(t, profileConfig+"profile: home\n")
+
+	if err := ApplyProfile(); err != nil {
+		t.Fatalf("ApplyProfile: %v", err)
+	}
+	if got := viper.GetString("service"); got != "中国电信" {
+		t.Errorf("service = %q, want the one of the home profile", got)
+	}
+}
+
+func TestApplyProfileErrors(t *testing.T) {
+	tests := []struct {
+		name, config, profile string
+		err                   string // Part of the expected error
+	}{
+		{"unknown profile", profileConfig, "work", `unknown profile "work" (available: broken, home, lab)`},
+		{"no profiles", "username: alice\n", "lab", "defines no profiles"},
+		{"not a section", profileConfig, "broken", "not a section"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags := loadConfig(t, tt.config)
+			if err := flags.Parse([]string{"--profile", tt.profile}); err != nil {
+				t.Fatal(err)
+			}
+
+			err := ApplyProfile()
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("ApplyProfile() = %v, want an error containing %q", err, tt.err)
+			}
+			if got := viper.GetString("username"); got != "alice" {
+				t.Errorf("username after a failed ApplyProfile = %q, want the base one", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,263 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Value types of config settings, named after their JSON Schema types
+const (
+	TypeString   = "string"
+	TypeBoolean  = "boolean"
+	TypeInteger  = "integer"
+	TypeNumber   = "number"
+	TypeDuration = "duration" // String parsed with time.ParseDuration, e.g. 30s
+	TypeIntList  = "integers" // List of integers
+	TypeStrMap   = "strings"  // Mapping of strings to strings
+)
+
+// Setting describes one key of the config file
+type Setting struct {
+	Key         string   // Dotted key, e.g. portal.base_url
+	Type        string   // One of the Type* constants
+	Description string   // One line shown in the schema
+	Enum        []string // Allowed values, empty allows any
+	Secret      bool     // Masked by "config get"
+}
+
+// Settings lists every key the config file may contain, profiles may hold all but profile and profiles
+var Settings = []Setting{
+	{Key: "profile", Type: TypeString, Description: "Profile used when --profile and RUIJIE_PROFILE are not given"},
+	{Key: "username", Type: TypeString, Description: "Username for authentication"},
+	{Key: "password", Type: TypeString, Description: "Password in plain text, prefer the credential vault", Secret: true},
+	{Key: "password_command", Type: TypeString, Description: "Command printing the password on its first line, split at spaces without a shell"},
+	{Key: "password_file", Type: TypeString, Description: "File holding the password on its first line"},
+	{Key: "vault", Type: TypeString, Description: "Encrypted credential vault, none disables it"},
+	{Key: "service", Type: TypeString, Description: "Service name, number or alias"},
+	{Key: "service_aliases", Type: TypeStrMap, Description: "Custom service aliases mapping to service names"},
+	{Key: "service_cache", Type: TypeString, Description: "File caching the service list, none disables it"},
+	{Key: "verbose", Type: TypeBoolean, Description: "Enable debug output"},
+	{Key: "output", Type: TypeString, Description: "Output format of reports", Enum: []string{"text", "json", "yaml"}},
+	{Key: "log_level", Type: TypeString, Description: "Log level", Enum: []string{"debug", "info", "warn", "error"}},
+	{Key: "log_format", Type: TypeString, Description: "Log format", Enum: []string{"text", "json"}},
+	{Key: "log_file", Type: TypeString, Description: "File logs are appended to"},
+	{Key: "proxy", Type: TypeString, Description: "Proxy URL for all portal traffic, or direct"},
+	{Key: "http_proxy", Type: TypeString, Description: "Proxy URL for HTTP requests"},
+	{Key: "https_proxy", Type: TypeString, Description: "Proxy URL for HTTPS requests"},
+	{Key: "all_proxy", Type: TypeString, Description: "Proxy URL for schemes without a dedicated proxy"},
+	{Key: "no_proxy", Type: TypeString, Description: "Hosts that bypass the proxy"},
+	{Key: "interface", Type: TypeString, Description: "Network interface portal traffic is bound to"},
+	{Key: "source_ip", Type: TypeString, Description: "Local address portal traffic is bound to"},
+	{Key: "timeout", Type: TypeDuration, Description: "Deadline of a whole command, 0 disables it"},
+	{Key: "step_timeout", Type: TypeDuration, Description: "Deadline of a single portal step"},
+	{Key: "state_file", Type: TypeString, Description: "Session state file, none disables it"},
+	{Key: "record", Type: TypeString, Description: "Directory portal exchanges are recorded to"},
+	{Key: "replay", Type: TypeString, Description: "Directory portal exchanges are replayed from"},
+	{Key: "har", Type: TypeString, Description: "HAR file portal exchanges are written to"},
+	{Key: "retry.attempts", Type: TypeInteger, Description: "Attempts per portal step, 1 disables retries"},
+	{Key: "retry.backoff", Type: TypeDuration, Description: "Delay before the first retry"},
+	{Key: "retry.max_backoff", Type: TypeDuration, Description: "Upper bound of a single retry delay"},
+	{Key: "retry.jitter", Type: TypeNumber, Description: "Fraction of the retry delay that is randomised"},
+	{Key: "retry.status_codes", Type: TypeIntList, Description: "HTTP status codes treated as transient"},
+	{Key: "captcha.solver", Type: TypeString, Description: "Captcha solver", Enum: []string{"interactive", "command", "http", "none"}},
+	{Key: "captcha.command", Type: TypeString, Description: "Command of the command solver, reads the image on stdin"},
+	{Key: "captcha.url", Type: TypeString, Description: "Endpoint of the http solver"},
+	{Key: "captcha.display", Type: TypeString, Description: "Display mode of the interactive solver", Enum: []string{"ascii", "file", "both"}},
+	{Key: "portal.base_url", Type: TypeString, Description: "Portal base URL"},
+	{Key: "portal.eportal_path", Type: TypeString, Description: "Prefix of the eportal API"},
+	{Key: "portal.cas_sso_path", Type: TypeString, Description: "Path of the cas-sso login page"},
+	{Key: "portal.redirect_url", Type: TypeString, Description: "URL probed for the captive portal redirect"},
+}
+
+// LookupSetting finds the setting of a key. Entries of a mapping such as
+// service_aliases.dx and keys inside profiles.NAME resolve to their setting.
+func LookupSetting(key string) (Setting, bool) {
+	key = strings.ToLower(key)
+	if rest, ok := strings.CutPrefix(key, "profiles."); ok {
+		_, profileKey, ok := strings.Cut(rest, ".")
+		if !ok || profileKey == "profile" || strings.HasPrefix(profileKey, "profiles.") {
+			return Setting{}, false
+		}
+		key = profileKey
+	}
+
+	for _, setting := range Settings {
+		if setting.Key == key {
+			return setting, true
+		}
+		if setting.Type == TypeStrMap && strings.HasPrefix(key, setting.Key+".") && !strings.Contains(key[len(setting.Key)+1:], ".") {
+			return Setting{Key: key, Type: TypeString, Description: setting.Description}, true
+		}
+	}
+	return Setting{}, false
+}
+
+// ParseValue converts the text of a value into the setting's type
+func (s Setting) ParseValue(text string) (interface{}, error) {
+	var value interface{}
+	var err error
+	switch s.Type {
+	case TypeBoolean:
+		value, err = strconv.ParseBool(text)
+	case TypeInteger:
+		value, err = strconv.Atoi(text)
+	case TypeNumber:
+		value, err = strconv.ParseFloat(text, 64)
+	case TypeDuration:
+		_, err = time.ParseDuration(text)
+		value = text
+	case TypeIntList:
+		codes := []int{}
+		for _, field := range strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == ' ' }) {
+			code, err := strconv.Atoi(field)
+			if err != nil {
+				return nil, fmt.Errorf("%s expects comma-separated integers: %w", s.Key, err)
+			}
+			codes = append(codes, code)
+		}
+		value = codes
+	case TypeStrMap:
+		return nil, fmt.Errorf("%s is a section, set its entries with %s.NAME", s.Key, s.Key)
+	default:
+		value = text
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s value for %s: %w", s.Type, s.Key, err)
+	}
+
+	return value, s.checkEnum(text)
+}
+
+// CheckValue checks a value read from the config file against the setting's type
+func (s Setting) CheckValue(value interface{}) error {
+	var ok bool
+	switch s.Type {
+	case TypeBoolean:
+		_, ok = value.(bool)
+	case TypeInteger:
+		_, ok = value.(int)
+	case TypeNumber:
+		switch value.(type) {
+		case int, float64:
+			ok = true
+		}
+	case TypeDuration:
+		var text string
+		if text, ok = value.(string); ok {
+			if _, err := time.ParseDuration(text); err != nil {
+				return fmt.Errorf("invalid duration %q", text)
+			}
+		}
+		// Plain integers are nanoseconds to viper
+		_, isInt := value.(int)
+		ok = ok || isInt
+	case TypeIntList:
+		var items []interface{}
+		if items, ok = value.([]interface{}); ok {
+			for _, item := range items {
+				if _, isInt := item.(int); !isInt {
+					return fmt.Errorf("expected a list of integers, got %v", item)
+				}
+			}
+		}
+	case TypeStrMap:
+		_, ok = value.(map[string]interface{})
+	default:
+		var text string
+		if text, ok = value.(string); ok {
+			return s.checkEnum(text)
+		}
+		// Numbers such as student IDs are fine as strings
+		switch value.(type) {
+		case int, float64, bool:
+			ok = true
+		}
+	}
+
+	if !ok {
+		return fmt.Errorf("expected %s, got %T", s.Type, value)
+	}
+	return nil
+}
+
+// checkEnum checks a value against the allowed values of the setting
+func (s Setting) checkEnum(text string) error {
+	if len(s.Enum) == 0 || text == "" {
+		return nil
+	}
+	for _, allowed := range s.Enum {
+		if text == allowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid value %q for %s (expected %s)", text, s.Key, strings.Join(s.Enum, ", "))
+}
+
+// JSONSchema returns a JSON Schema of the config file for editor completion and validation
+func JSONSchema() map[string]interface{} {
+	root := schemaObject()
+	profile := schemaObject()
+	for _, setting := range Settings {
+		addSchemaProperty(root, strings.Split(setting.Key, "."), setting)
+		if setting.Key != "profile" {
+			addSchemaProperty(profile, strings.Split(setting.Key, "."), setting)
+		}
+	}
+	root["properties"].(map[string]interface{})["profiles"] = map[string]interface{}{
+		"type":                 "object",
+		"description":          "Named profiles overriding the settings above",
+		"additionalProperties": profile,
+	}
+
+	root["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	root["title"] = "ruijie-go configuration"
+	return root
+}
+
+// schemaObject returns an empty object schema that rejects unknown keys
+func schemaObject() map[string]interface{} {
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           map[string]interface{}{},
+		"additionalProperties": false,
+	}
+}
+
+// addSchemaProperty adds a setting to an object schema, creating the sections of a dotted key
+func addSchemaProperty(object map[string]interface{}, path []string, setting Setting) {
+	properties := object["properties"].(map[string]interface{})
+	if len(path) > 1 {
+		section, ok := properties[path[0]].(map[string]interface{})
+		if !ok {
+			section = schemaObject()
+			properties[path[0]] = section
+		}
+		addSchemaProperty(section, path[1:], setting)
+		return
+	}
+
+	property := map[string]interface{}{"description": setting.Description}
+	switch setting.Type {
+	case TypeDuration:
+		property["type"] = "string"
+		property["pattern"] = `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$|^0$`
+	case TypeIntList:
+		property["type"] = "array"
+		property["items"] = map[string]interface{}{"type": "integer"}
+	case TypeStrMap:
+		property["type"] = "object"
+		property["additionalProperties"] = map[string]interface{}{"type": "string"}
+	case TypeString:
+		// Usernames are often written as numbers
+		property["type"] = []string{"string", "number"}
+	default:
+		property["type"] = setting.Type
+	}
+	if len(setting.Enum) > 0 {
+		property["type"] = "string"
+		property["enum"] = setting.Enum
+	}
+	properties[path[0]] = property
+}
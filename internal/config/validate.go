@@ -0,0 +1,219 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"ruijie-go/internal/models"
+	"ruijie-go/internal/services"
+	"ruijie-go/internal/vault"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Problem is an issue found in a config file
+type Problem struct {
+	Key     string // Dotted key the problem is about
+	Message string
+	Warning bool // The config still works, e.g. a check could not be done
+}
+
+func (p Problem) String() string {
+	level := "error"
+	if p.Warning {
+		level = "warning"
+	}
+	return fmt.Sprintf("%s: %s: %s", level, p.Key, p.Message)
+}
+
+// ValidateFile checks a config file for unknown keys, bad values, services
+// missing from the cached service list and unreadable credential sources. The
+// error is only set if the file cannot be read or parsed at all.
+func ValidateFile(path string, cached *models.ServiceList) ([]Problem, error) {
+	// JSON is valid YAML, TOML is not
+	if filepath.Ext(path) == ".toml" {
+		return nil, notYAMLError(path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	var settings map[string]interface{}
+	if err := yaml.Unmarshal(data, &settings); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	v := &validator{cached: cached}
+	profiles, _ := settings["profiles"].(map[string]interface{})
+	if value, ok := settings["profiles"]; ok && profiles == nil && value != nil {
+		v.errorf("profiles", "expected a section of named profiles")
+	}
+
+	v.checkKeys("", settings)
+	v.checkScope("", settings, nil)
+	for name, value := range profiles {
+		profile, ok := value.(map[string]interface{})
+		if !ok {
+			v.errorf("profiles."+name, "expected a section of settings")
+			continue
+		}
+		v.checkKeys("profiles."+name+".", profile)
+		v.checkScope("profiles."+name+".", profile, settings)
+	}
+
+	if name, ok := settings["profile"].(string); ok && name != "" {
+		if _, ok := profiles[strings.ToLower(name)]; !ok {
+			v.errorf("profile", "profile %q is not defined in profiles", name)
+		}
+	}
+
+	sort.SliceStable(v.problems, func(i, j int) bool {
+		return v.problems[i].Key < v.problems[j].Key
+	})
+	return v.problems, nil
+}
+
+// validator collects the problems of a config file
+type validator struct {
+	cached       *models.ServiceList
+	problems     []Problem
+	warnedNoList bool
+}
+
+func (v *validator) errorf(key, format string, args ...interface{}) {
+	v.problems = append(v.problems, Problem{Key: key, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) warnf(key, format string, args ...interface{}) {
+	v.problems = append(v.problems, Problem{Key: key, Message: fmt.Sprintf(format, args...), Warning: true})
+}
+
+// checkKeys reports unknown keys and values of the wrong type below prefix
+func (v *validator) checkKeys(prefix string, settings map[string]interface{}) {
+	for key, value := range settings {
+		full := prefix + key
+		if full == "profiles" {
+			continue
+		}
+
+		setting, ok := LookupSetting(full)
+		if !ok {
+			if section, isMap := value.(map[string]interface{}); isMap && isSection(full) {
+				v.checkKeys(full+".", section)
+				continue
+			}
+			v.errorf(full, "unknown key")
+			continue
+		}
+		if err := setting.CheckValue(value); err != nil {
+			v.errorf(full, "%v", err)
+			continue
+		}
+		if setting.Type == TypeStrMap {
+			for name, target := range value.(map[string]interface{}) {
+				if _, isString := target.(string); !isString {
+					v.errorf(full+"."+name, "expected a service name, got %T", target)
+				}
+			}
+		}
+	}
+}
+
+// isSection reports whether a dotted key is a section such as portal or profiles.lab.retry
+func isSection(key string) bool {
+	if rest, ok := strings.CutPrefix(key, "profiles."); ok {
+		_, key, ok = strings.Cut(rest, ".")
+		if !ok {
+			return false
+		}
+	}
+	for _, setting := range Settings {
+		if strings.HasPrefix(setting.Key, key+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkScope checks the service names and credential sources of the top
+// level or of a profile, base holds the top level settings of a profile
+func (v *validator) checkScope(prefix string, settings, base map[string]interface{}) {
+	aliases := map[string]string{}
+	for _, scope := range []map[string]interface{}{base, settings} {
+		if section, ok := scope["service_aliases"].(map[string]interface{}); ok {
+			for name, target := range section {
+				if text, ok := target.(string); ok {
+					aliases[name] = text
+				}
+			}
+		}
+	}
+
+	if service, ok := settings["service"]; ok {
+		v.checkService(prefix+"service", fmt.Sprint(service), services.NewResolver(aliases))
+	}
+	if section, ok := settings["service_aliases"].(map[string]interface{}); ok {
+		for name, target := range section {
+			if text, ok := target.(string); ok {
+				v.checkService(prefix+"service_aliases."+name, text, services.NewResolver(nil))
+			}
+		}
+	}
+
+	if command, ok := settings["password_command"].(string); ok && command != "" {
+		v.checkCommand(prefix+"password_command", command)
+	}
+	if section, ok := settings["captcha"].(map[string]interface{}); ok {
+		command, _ := section["command"].(string)
+		if command != "" {
+			v.checkCommand(prefix+"captcha.command", command)
+		} else if section["solver"] == "command" {
+			v.errorf(prefix+"captcha.command", "the command solver needs a command")
+		}
+	}
+	if path, ok := settings["password_file"].(string); ok && path != "" {
+		if _, err := readPasswordFile(path); err != nil {
+			v.errorf(prefix+"password_file", "%v", err)
+		}
+	}
+	if path, ok := settings["vault"].(string); ok && path != "" && path != "none" {
+		if _, err := vault.KeySource(path); errors.Is(err, fs.ErrNotExist) {
+			v.warnf(prefix+"vault", "%s does not exist yet, create it with \"ruijie-go credentials set\"", path)
+		} else if err != nil {
+			v.errorf(prefix+"vault", "%v", err)
+		}
+	}
+}
+
+// checkCommand checks that the program of a command split at spaces exists
+func (v *validator) checkCommand(key, command string) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		v.errorf(key, "command is blank")
+		return
+	}
+	if _, err := exec.LookPath(args[0]); err != nil {
+		v.errorf(key, "%v", err)
+	}
+}
+
+// checkService checks a service name or alias against the cached service list
+func (v *validator) checkService(key, service string, resolver *services.Resolver) {
+	if v.cached == nil || len(v.cached.Services) == 0 {
+		if !v.warnedNoList {
+			v.warnf(key, "service names are not checked without a cached service list, run \"ruijie-go services\" once")
+			v.warnedNoList = true
+		}
+		return
+	}
+	if _, err := resolver.ResolveService(v.cached, service); err != nil {
+		v.errorf(key, "%v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"ruijie-go/internal/models"
+)
+
+// cachedServices is the service list the service names are checked against
+var cachedServices = &models.ServiceList{Services: []models.Service{
+	{Name: "校园网", Available: true},
+	{Name: "中国电信", Available: true},
+}}
+
+func TestValidateFile(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing")
+
+	tests := []struct {
+		name    string
+		content string
+		want    []string // Level and key of every problem
+	}{
+		{"valid", "username: alice\nservice: dianxin\nservice_aliases:\n  home: 中国电信\nretry:\n  attempts: 3\n", nil},
+		{"unknown key", "usernmae: alice\nportal:\n  url: http://portal\n", []string{"error: portal.url", "error: usernmae"}},
+		{"bad values", "output: xml\ntimeout: soon\nretry:\n  attempts: three\n", []string{"error: output", "error: retry.attempts", "error: timeout"}},
+		{"unknown service", "service: 中国移动\nservice_aliases:\n  work: 中国联通\n", []string{"error: service", "error: service_aliases.work"}},
+		{"alias of an alias", "service: home\nservice_aliases:\n  home: dx\n", nil},
+		{"profiles", "profile: home\nprofiles:\n  lab:\n    service: yidong\n    colour: red\n", []string{"error: profile", "error: profiles.lab.colour", "error: profiles.lab.service"}},
+		{"profile uses base aliases", "service_aliases:\n  home: 中国电信\nprofiles:\n  lab:\n    service: home\n", nil},
+		{"blank command", "password_command: '   '\n", []string{"error: password_command"}},
+		{"missing command", "captcha:\n  command: /nonexistent/solve-captcha\n", []string{"error: captcha.command"}},
+		{"command solver without command", "captcha:\n  solver: command\n", []string{"error: captcha.command"}},
+		{"missing password file", "password_file: " + missing + "\n", []string{"error: password_file"}},
+		{"missing vault", "vault: " + missing + "\n", []string{"warning: vault"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems, err := ValidateFile(writeConfig(t, tt.content), cachedServices)
+			if err != nil {
+				t.Fatalf("ValidateFile: %v", err)
+			}
+
+			var got []string
+			for _, problem := range problems {
+				level, key, _ := strings.Cut(problem.String(), ": ")
+				key, _, _ = strings.Cut(key, ": ")
+				got = append(got, level+": "+key)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("problems = %v, want %v", problems, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateFileWithoutServiceList(t *testing.T) {
+	problems, err := ValidateFile(writeConfig(t, "service: dx\nprofiles:\n  lab:\n    service: yidong\n"), nil)
+	if err != nil {
+		t.Fatalf("ValidateFile: %v", err)
+	}
+	if len(problems) != 1 || !problems[0].Warning {
+		t.Errorf("problems = %v, want a single warning about the missing service list", problems)
+	}
+}
+
+func TestValidateFileUnreadable(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"config.yaml":     "username: [alice\n",
+		".ruijie-go.toml": "username = \"alice\"\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ValidateFile(path, nil); err == nil {
+			t.Errorf("ValidateFile(%s) succeeded", name)
+		}
+	}
+	if _, err := ValidateFile(filepath.Join(dir, "missing.yaml"), nil); err == nil {
+		t.Error("ValidateFile of a missing file succeeded")
+	}
+}
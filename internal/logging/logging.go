@@ -0,0 +1,127 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces secret values in log output
+const Redacted = "[REDACTED]"
+
+// Options configures the application logger
+type Options struct {
+	Level  string // debug, info, warn or error
+	Format string // text or json
+	File   string // Optional file the log is appended to, in addition to stderr
+}
+
+// secretKeys are attribute keys whose values are never logged
+var secretKeys = map[string]bool{
+	"password":        true,
+	"passphrase":      true,
+	"croypto":         true,
+	"key":             true,
+	"execution":       true,
+	"ticket":          true,
+	"captcha_payload": true,
+	"cookie":          true,
+	"cookies":         true,
+	"set-cookie":      true,
+	"authorization":   true,
+	"token":           true,
+	"secret":          true,
+}
+
+// secretParams matches secret query and form parameters inside free text such as URLs
+var secretParams = regexp.MustCompile(`(?i)\b(password|croypto|execution|ticket|captcha_payload|token)=[^&\s"']+`)
+
+// New creates a logger writing to stderr and, if configured, to a log file.
+// The returned close function releases the log file.
+func New(opts Options) (*slog.Logger, func() error, error) {
+	level, err := ParseLevel(opts.Level)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var out io.Writer = os.Stderr
+	closeFn := func() error { return nil }
+	if opts.File != "" {
+		if err := os.MkdirAll(filepath.Dir(opts.File), 0700); err != nil {
+			return nil, nil, fmt.Errorf("failed to create log directory: %w", err)
+		}
+		file, err := os.OpenFile(opts.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open log file: %w", err)
+		}
+		out = io.MultiWriter(os.Stderr, file)
+		closeFn = file.Close
+	}
+
+	handlerOpts := &slog.HandlerOptions{Level: level, ReplaceAttr: redactAttr}
+	var handler slog.Handler
+	switch strings.ToLower(opts.Format) {
+	case "", "text":
+		handler = slog.NewTextHandler(out, handlerOpts)
+	case "json":
+		handler = slog.NewJSONHandler(out, handlerOpts)
+	default:
+		return nil, nil, fmt.Errorf("unknown log format %q (expected text or json)", opts.Format)
+	}
+
+	return slog.New(handler), closeFn, nil
+}
+
+// ParseLevel converts a level name into a slog level, empty means warn
+func ParseLevel(name string) (slog.Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "", "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return 0, fmt.Errorf("unknown log level %q (expected debug, info, warn or error)", name)
+	}
+}
+
+// Discard returns a logger that drops everything
+func Discard() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError + 1}))
+}
+
+// RedactString masks secret parameters embedded in free text such as URLs or form bodies
+func RedactString(value string) string {
+	return secretParams.ReplaceAllStringFunc(value, func(match string) string {
+		name, _, _ := strings.Cut(match, "=")
+		return name + "=" + Redacted
+	})
+}
+
+// IsSecretKey reports whether values stored under key must never be logged
+func IsSecretKey(key string) bool {
+	return secretKeys[strings.ToLower(key)]
+}
+
+// redactAttr masks secret attributes before they reach the handler
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	if IsSecretKey(a.Key) {
+		return slog.String(a.Key, Redacted)
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		a.Value = slog.StringValue(RedactString(a.Value.String()))
+	case slog.KindAny:
+		a.Value = slog.StringValue(RedactString(fmt.Sprintf("%+v", a.Value.Any())))
+	}
+
+	return a
+}
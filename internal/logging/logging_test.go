@@ -0,0 +1,86 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestRedactString(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{
+			"form body",
+			"username=test&password=hunter2&croypto=a2V5&execution=e1s1&captcha_payload=eyJ9&_eventId=submit",
+			"username=test&password=[REDACTED]&croypto=[REDACTED]&execution=[REDACTED]&captcha_payload=[REDACTED]&_eventId=submit",
+		},
+		{
+			"url",
+			"https://auth1.ysu.edu.cn/cas-sso/auth-success?ticket=ST-1-abc&token=xyz",
+			"https://auth1.ysu.edu.cn/cas-sso/auth-success?ticket=[REDACTED]&token=[REDACTED]",
+		},
+		{
+			"case insensitive",
+			"Password=hunter2 TICKET=ST-1",
+			"Password=[REDACTED] TICKET=[REDACTED]",
+		},
+		{
+			"quoted",
+			`error="POST ...?password=hunter2"`,
+			`error="POST ...?password=[REDACTED]"`,
+		},
+		{
+			"other parameters",
+			"sessionId=abc&service=%E6%A0%A1&userIp=10.0.0.2",
+			"sessionId=abc&service=%E6%A0%A1&userIp=10.0.0.2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RedactString(tt.in); got != tt.want {
+				t.Errorf("RedactString(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactAttr(t *testing.T) {
+	tests := []struct {
+		name   string
+		attr   slog.Attr
+		secret string // Must not be logged
+		keep   string // Must still be logged
+	}{
+		{"password", slog.String("password", "hunter2"), "hunter2", "password=[REDACTED]"},
+		{"croypto", slog.String("croypto", "a2V5"), "a2V5", "croypto=[REDACTED]"},
+		{"execution", slog.String("execution", "e1s1"), "e1s1", "execution=[REDACTED]"},
+		{"token", slog.String("token", "xyz"), "xyz", "token=[REDACTED]"},
+		{"cookie", slog.String("Cookie", "CASTGC=TGT-1"), "TGT-1", "Cookie=[REDACTED]"},
+		{"set-cookie", slog.String("Set-Cookie", "JSESSIONID=abc"), "abc", "Set-Cookie=[REDACTED]"},
+		{"secret key of another kind", slog.Int("ticket", 271828183), "271828183", "ticket=[REDACTED]"},
+		{"url", slog.String("url", "https://portal/auth-success?ticket=ST-1-abc"), "ST-1-abc", "ticket=[REDACTED]"},
+		{"error", slog.Any("error", errors.New("login failed: password=hunter2")), "hunter2", "login failed"},
+		{"group", slog.Group("form", slog.String("password", "hunter2"), slog.String("username", "test")), "hunter2", "form.username=test"},
+		{"plain", slog.String("sessionId", "abc"), "", "sessionId=abc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{ReplaceAttr: redactAttr}))
+			logger.Info("test", tt.attr)
+
+			output := buf.String()
+			if tt.secret != "" && strings.Contains(output, tt.secret) {
+				t.Errorf("log %q contains the secret %q", output, tt.secret)
+			}
+			if !strings.Contains(output, tt.keep) {
+				t.Errorf("log %q does not contain %q", output, tt.keep)
+			}
+		})
+	}
+}
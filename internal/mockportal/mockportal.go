@@ -0,0 +1,631 @@
+// Package mockportal emulates a Ruijie V2 portal with CAS-SSO login, so the
+// client and CLI can be exercised end to end without the campus network.
+package mockportal
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ruijie-go/internal/client"
+)
+
+// Failure modes that can be scripted per endpoint
+const (
+	FailWrongPassword = "wrong-password" // cas-sso rejects the password
+	FailCaptcha       = "captcha"        // cas-sso demands a captcha
+	FailExpired       = "expired"        // cas-sso reports the login form as expired
+	FailSlow          = "slow"           // the response is delayed by Options.Delay
+	FailMalformedJSON = "malformed-json" // the response body is truncated JSON
+	FailServerError   = "5xx"            // the response is 502 Bad Gateway
+	FailUnknownNode   = "unknown-node"   // getCurrentNode reports a node no client handles
+	FailStuckNode     = "stuck-node"     // getCurrentNode keeps reporting the cas-sso node
+)
+
+// unknownNode is the workflow node reported by the unknown-node mode
+const unknownNode = "smsVerify"
+
+// Endpoint names used in failure rules
+const (
+	EndpointRedirect         = "redirect"
+	EndpointCasSSO           = "cas-sso"
+	EndpointCurrentNode      = "getCurrentNode"
+	EndpointServiceSelection = "serviceSelection"
+	EndpointServiceLogin     = "serviceLogin"
+	EndpointUserOnline       = "userOnline"
+	EndpointAccountInfo      = "getAccountInfo"
+	EndpointOffline          = "offline"
+	EndpointOnlineUserInfo   = "getOnlineUserInfo"
+	EndpointAny              = "*"
+)
+
+// Session parameters handed out by the portal redirect
+const (
+	mockUserIP       = "10.0.0.2"
+	mockNasIP        = "10.0.0.1"
+	mockCustomPageID = "1"
+	mockSSID         = "ysu"
+	mockMode         = "history"
+)
+
+// casTicketCookie is the ticket-granting cookie that lets a later cas-sso visit skip the form
+const casTicketCookie = "CASTGC"
+
+// Options configures the mock portal
+type Options struct {
+	Username    string        // Accepted user name, default "test"
+	Password    string        // Accepted password, default "test"
+	Services    []string      // Offered services, default the four YSU services
+	CaptchaCode string        // Code expected when a captcha is shown, default "1234"
+	Delay       time.Duration // Delay of the "slow" failure mode, default 3s
+}
+
+// Rule injects a failure into the responses of an endpoint
+type Rule struct {
+	Endpoint string // Endpoint name or "*" for all endpoints
+	Mode     string // One of the Fail* modes
+	Times    int    // Number of responses affected, 0 means all
+}
+
+// ParseRule parses a rule written as endpoint=mode[:times]
+func ParseRule(spec string) (Rule, error) {
+	endpoint, mode, ok := strings.Cut(spec, "=")
+	if !ok || endpoint == "" || mode == "" {
+		return Rule{}, fmt.Errorf("invalid failure rule %q (expected endpoint=mode[:times])", spec)
+	}
+
+	rule := Rule{Endpoint: endpoint, Mode: mode}
+	if mode, times, ok := strings.Cut(mode, ":"); ok {
+		n, err := strconv.Atoi(times)
+		if err != nil || n < 0 {
+			return Rule{}, fmt.Errorf("invalid repeat count in failure rule %q", spec)
+		}
+		rule.Mode, rule.Times = mode, n
+	}
+
+	switch rule.Mode {
+	case FailWrongPassword, FailCaptcha, FailExpired, FailSlow, FailMalformedJSON, FailServerError,
+		FailUnknownNode, FailStuckNode:
+	default:
+		return Rule{}, fmt.Errorf("unknown failure mode %q", rule.Mode)
+	}
+
+	return rule, nil
+}
+
+// loginPage is a cas-sso login form handed out to a client
+type loginPage struct {
+	key     []byte
+	captcha bool
+}
+
+// Server is a running mock portal
+type Server struct {
+	URL string
+
+	opts   Options
+	server *httptest.Server
+
+	mu            sync.Mutex
+	rules         []*Rule
+	pages         map[string]*loginPage // execution -> login form
+	authenticated map[string]bool       // portal sessions that passed cas-sso
+	tickets       map[string]bool       // valid CAS ticket-granting cookies
+	online        bool
+	service       string
+	loginTime     time.Time
+}
+
+// New creates a mock portal, Start makes it listen
+func New(opts Options) *Server {
+	if opts.Username == "" {
+		opts.Username = "test"
+	}
+	if opts.Password == "" {
+		opts.Password = "test"
+	}
+	if len(opts.Services) == 0 {
+		opts.Services = []string{"校园网", "中国联通", "中国电信", "中国移动"}
+	}
+	if opts.CaptchaCode == "" {
+		opts.CaptchaCode = "1234"
+	}
+	if opts.Delay <= 0 {
+		opts.Delay = 3 * time.Second
+	}
+
+	return &Server{
+		opts:          opts,
+		pages:         make(map[string]*loginPage),
+		authenticated: make(map[string]bool),
+		tickets:       make(map[string]bool),
+	}
+}
+
+// Start serves the portal on listener, a nil listener picks a free loopback port
+func (s *Server) Start(listener net.Listener) {
+	s.server = httptest.NewUnstartedServer(s.Handler())
+	if listener != nil {
+		s.server.Listener.Close()
+		s.server.Listener = listener
+	}
+	s.server.Start()
+	s.URL = s.server.URL
+}
+
+// Close stops the server
+func (s *Server) Close() {
+	if s.server != nil {
+		s.server.Close()
+	}
+}
+
+// AddRule scripts a failure, rules are consulted in the order they were added
+func (s *Server) AddRule(rule Rule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = append(s.rules, &rule)
+}
+
+// Online reports whether a user is logged in and to which service
+func (s *Server) Online() (bool, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.online, s.service
+}
+
+// Handler returns the HTTP handler of the portal
+func (s *Server) Handler() http.Handler {
+	eportal := client.DefaultEportalPath
+	casSSO := client.DefaultCasSSOPath
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(eportal+"/redirect.jsp", s.wrap(EndpointRedirect, s.handleRedirect))
+	mux.HandleFunc(eportal+"/index.jsp", s.handleIndex)
+	mux.HandleFunc("/portal-main/", s.handlePortalMain)
+	mux.HandleFunc(casSSO, s.wrap(EndpointCasSSO, s.handleCasSSO))
+	mux.HandleFunc(casSSO+"/captcha.jpg", s.handleCaptchaImage)
+	mux.HandleFunc("/cas-sso/auth-success", s.handleAuthSuccess)
+	mux.HandleFunc(eportal+"/workFlow/getCurrentNode", s.wrap(EndpointCurrentNode, s.handleCurrentNode))
+	mux.HandleFunc(eportal+"/network/serviceSelection", s.wrap(EndpointServiceSelection, s.handleServiceSelection))
+	mux.HandleFunc(eportal+"/network/serviceLogin", s.wrap(EndpointServiceLogin, s.handleServiceLogin))
+	mux.HandleFunc(eportal+"/network/userOnline", s.wrap(EndpointUserOnline, s.handleUserOnline))
+	mux.HandleFunc(eportal+"/network/offline", s.wrap(EndpointOffline, s.handleOffline))
+	mux.HandleFunc(eportal+"/operator/getAccountInfo", s.wrap(EndpointAccountInfo, s.handleAccountInfo))
+	mux.HandleFunc(eportal+"/adaptor/getOnlineUserInfo", s.wrap(EndpointOnlineUserInfo, s.handleOnlineUserInfo))
+
+	return mux
+}
+
+// take consumes the first matching rule of endpoint whose mode is in modes
+func (s *Server) take(endpoint string, modes ...string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, rule := range s.rules {
+		if rule.Endpoint != endpoint && rule.Endpoint != EndpointAny {
+			continue
+		}
+		matched := false
+		for _, mode := range modes {
+			matched = matched || rule.Mode == mode
+		}
+		if !matched {
+			continue
+		}
+
+		if rule.Times > 0 {
+			rule.Times--
+			if rule.Times == 0 {
+				s.rules = append(s.rules[:i], s.rules[i+1:]...)
+			}
+		}
+		return rule.Mode
+	}
+
+	return ""
+}
+
+// wrap applies the transport-level failure modes before calling the handler
+func (s *Server) wrap(endpoint string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		switch s.take(endpoint, FailSlow, FailServerError, FailMalformedJSON) {
+		case FailSlow:
+			select {
+			case <-time.After(s.opts.Delay):
+			case <-req.Context().Done():
+				return
+			}
+		case FailServerError:
+			http.Error(w, "upstream portal unavailable", http.StatusBadGateway)
+			return
+		case FailMalformedJSON:
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"code":200,"message":"success","data":{`)
+			return
+		}
+		handler(w, req)
+	}
+}
+
+// writeData writes a successful eportal envelope
+func writeData(w http.ResponseWriter, data interface{}) {
+	writeEnvelope(w, 200, "success", data)
+}
+
+// writeEnvelope writes an eportal JSON envelope
+func writeEnvelope(w http.ResponseWriter, code int, message string, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"code":    code,
+		"message": message,
+		"data":    data,
+	})
+}
+
+// readSessionID extracts the sessionId of a JSON request body
+func readSessionID(req *http.Request) (string, map[string]interface{}) {
+	var body map[string]interface{}
+	json.NewDecoder(req.Body).Decode(&body)
+	sessionID, _ := body["sessionId"].(string)
+	return sessionID, body
+}
+
+// randomToken returns n random bytes, hex encoded
+func randomToken(n int) string {
+	buf := make([]byte, n)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+func (s *Server) handleRedirect(w http.ResponseWriter, req *http.Request) {
+	// The real gateway answers with a JavaScript hop to the eportal index
+	target := client.DefaultEportalPath + "/index.jsp?" + url.Values{
+		"nasip":  {mockNasIP},
+		"userip": {mockUserIP},
+	}.Encode()
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<script>top.self.location.href='%s%s'</script>\n", s.baseURL(req), target)
+}
+
+func (s *Server) handleIndex(w http.ResponseWriter, req *http.Request) {
+	query := url.Values{
+		"sessionId":    {randomToken(16)},
+		"customPageId": {mockCustomPageID},
+		"nasIp":        {mockNasIP},
+		"userIp":       {mockUserIP},
+		"ssid":         {mockSSID},
+		"mode":         {mockMode},
+	}
+	http.Redirect(w, req, "/portal-main/index.html?"+query.Encode(), http.StatusFound)
+}
+
+func (s *Server) handlePortalMain(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, "<html><body>Mock Ruijie portal</body></html>\n")
+}
+
+func (s *Server) handleAuthSuccess(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, "<html><body>Authentication succeeded</body></html>\n")
+}
+
+// baseURL returns the scheme and host the client used to reach the server
+func (s *Server) baseURL(req *http.Request) string {
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + req.Host
+}
+
+func (s *Server) handleCasSSO(w http.ResponseWriter, req *http.Request) {
+	sessionID := req.URL.Query().Get("flowSessionId")
+
+	if req.Method == http.MethodPost {
+		s.handleCasSSOSubmit(w, req, sessionID)
+		return
+	}
+
+	// A valid ticket-granting cookie skips the login form
+	if cookie, err := req.Cookie(casTicketCookie); err == nil {
+		s.mu.Lock()
+		valid := s.tickets[cookie.Value]
+		if valid {
+			s.authenticated[sessionID] = true
+		}
+		s.mu.Unlock()
+		if valid {
+			http.Redirect(w, req, "/cas-sso/auth-success?ticket=ST-"+randomToken(8), http.StatusFound)
+			return
+		}
+	}
+
+	key := make([]byte, 16)
+	rand.Read(key)
+	execution := randomToken(24)
+	page := &loginPage{key: key, captcha: s.take(EndpointCasSSO, FailCaptcha) != ""}
+
+	s.mu.Lock()
+	s.pages[execution] = page
+	s.mu.Unlock()
+
+	captchaStyle := ` style="display:none"`
+	if page.captcha {
+		captchaStyle = ""
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, `<html><body>
+<p id="login-croypto" style="display:none">%s</p>
+<p id="login-page-flowkey" style="display:none">%s</p>
+<form method="post">
+<div class="captcha"%s><img id="captcha-img" src="%s/captcha.jpg"></div>
+</form>
+</body></html>
+`, base64.StdEncoding.EncodeToString(key), execution, captchaStyle, client.DefaultCasSSOPath)
+}
+
+// handleCasSSOSubmit checks the login form posted to cas-sso
+func (s *Server) handleCasSSOSubmit(w http.ResponseWriter, req *http.Request, sessionID string) {
+	if err := req.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	page := s.pages[req.PostForm.Get("execution")]
+	delete(s.pages, req.PostForm.Get("execution"))
+	s.mu.Unlock()
+
+	fail := func(message string) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(w, "<html><body><div id=\"errorMessage\">%s</div></body></html>\n", html.EscapeString(message))
+	}
+
+	if page == nil || s.take(EndpointCasSSO, FailExpired) != "" {
+		fail("登录页面已过期，请刷新后重试")
+		return
+	}
+	if req.PostForm.Get("croypto") != base64.StdEncoding.EncodeToString(page.key) {
+		fail("登录页面已过期，请刷新后重试")
+		return
+	}
+
+	password, err := decryptECB(page.key, req.PostForm.Get("password"))
+	if err != nil || req.PostForm.Get("username") != s.opts.Username || password != s.opts.Password ||
+		s.take(EndpointCasSSO, FailWrongPassword) != "" {
+		fail("用户名或密码错误")
+		return
+	}
+
+	if page.captcha {
+		var payload struct {
+			CaptchaCode string `json:"captcha_code"`
+		}
+		plaintext, err := decryptECB(page.key, req.PostForm.Get("captcha_payload"))
+		if err == nil {
+			err = json.Unmarshal([]byte(plaintext), &payload)
+		}
+		if err != nil || payload.CaptchaCode != s.opts.CaptchaCode {
+			fail("验证码错误")
+			return
+		}
+	}
+
+	ticket := randomToken(16)
+	s.mu.Lock()
+	s.authenticated[sessionID] = true
+	s.tickets[ticket] = true
+	s.mu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{Name: casTicketCookie, Value: ticket, Path: "/cas-sso", HttpOnly: true})
+	http.Redirect(w, req, "/cas-sso/auth-success?ticket=ST-"+randomToken(8), http.StatusFound)
+}
+
+func (s *Server) handleCaptchaImage(w http.ResponseWriter, req *http.Request) {
+	img := image.NewGray(image.Rect(0, 0, 80, 24))
+	for x := 0; x < 80; x++ {
+		for y := 0; y < 24; y++ {
+			if (x/4+y/6)%3 == 0 {
+				img.SetGray(x, y, color.Gray{Y: 40})
+			} else {
+				img.SetGray(x, y, color.Gray{Y: 230})
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, img, nil)
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Write(buf.Bytes())
+}
+
+func (s *Server) handleCurrentNode(w http.ResponseWriter, req *http.Request) {
+	sessionID, _ := readSessionID(req)
+
+	mode := s.take(EndpointCurrentNode, FailUnknownNode, FailStuckNode)
+
+	s.mu.Lock()
+	node := client.NodeCasSSO
+	switch {
+	case mode == FailUnknownNode:
+		node = unknownNode
+	case mode == FailStuckNode:
+	case s.online:
+		node = client.NodeSuccess
+	case s.authenticated[sessionID]:
+		node = client.NodeServiceSelection
+	}
+	s.mu.Unlock()
+
+	writeData(w, map[string]string{"currentNodePath": "/portal_auth/" + node})
+}
+
+func (s *Server) handleServiceSelection(w http.ResponseWriter, req *http.Request) {
+	sessionID, _ := readSessionID(req)
+
+	s.mu.Lock()
+	allowed := s.online || s.authenticated[sessionID]
+	s.mu.Unlock()
+	if !allowed {
+		writeEnvelope(w, 401, "会话已失效，请重新认证", nil)
+		return
+	}
+
+	services := make([]map[string]interface{}, 0, len(s.opts.Services))
+	for i, name := range s.opts.Services {
+		services = append(services, map[string]interface{}{
+			"serviceName": name,
+			"serviceId":   i + 1,
+			"default":     i == 0,
+		})
+	}
+	writeData(w, map[string]interface{}{"services": services})
+}
+
+func (s *Server) handleServiceLogin(w http.ResponseWriter, req *http.Request) {
+	sessionID, body := readSessionID(req)
+	service, _ := body["service"].(string)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.authenticated[sessionID] {
+		writeEnvelope(w, 401, "会话已失效，请重新认证", nil)
+		return
+	}
+
+	known := false
+	for _, name := range s.opts.Services {
+		known = known || name == service
+	}
+	if !known {
+		writeData(w, map[string]string{"authResult": "fail", "authMessage": "所选服务不可用"})
+		return
+	}
+
+	s.online = true
+	s.service = service
+	s.loginTime = time.Now()
+	writeData(w, map[string]string{"authResult": "success", "authMessage": ""})
+}
+
+func (s *Server) handleUserOnline(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	online := s.online
+	s.mu.Unlock()
+
+	message := ""
+	if !online {
+		message = "用户不在线"
+	}
+	writeData(w, map[string]interface{}{"online": online, "message": message})
+}
+
+func (s *Server) handleOffline(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	s.online = false
+	s.service = ""
+	s.authenticated = make(map[string]bool)
+	s.mu.Unlock()
+
+	writeEnvelope(w, 200, "success", nil)
+}
+
+func (s *Server) handleAccountInfo(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	online, service := s.online, s.service
+	s.mu.Unlock()
+
+	if !online {
+		writeEnvelope(w, 401, "用户不在线", nil)
+		return
+	}
+
+	writeData(w, map[string]interface{}{
+		"name":          s.opts.Username,
+		"service":       service,
+		"allowMab":      true,
+		"nosenseEnable": false,
+		"goLink":        s.baseURL(req) + "/portal-main/index.html",
+		"accountInfo": []map[string]string{
+			{"title": "账户余额", "content": "100.00元"},
+			{"title": "到期时间", "content": "2099-12-31"},
+		},
+		"macNum": 3,
+	})
+}
+
+func (s *Server) handleOnlineUserInfo(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	online, service, loginTime := s.online, s.service, s.loginTime
+	s.mu.Unlock()
+
+	if !online {
+		redirectURL := s.baseURL(req) + client.DefaultEportalPath + "/redirect.jsp?mode=history"
+		writeData(w, map[string]interface{}{
+			"portalOnlineUserInfo": map[string]interface{}{"redirectUrl": redirectURL},
+			"onlineUser":           nil,
+		})
+		return
+	}
+
+	writeData(w, map[string]interface{}{
+		"portalOnlineUserInfo": map[string]interface{}{
+			"userName":    s.opts.Username,
+			"userId":      s.opts.Username,
+			"service":     service,
+			"userIp":      mockUserIP,
+			"redirectUrl": nil,
+		},
+		"onlineUser": map[string]interface{}{
+			"authenticationTime":   loginTime.Format("2006-01-02 15:04:05"),
+			"nodePhysicalLocation": "Mock building",
+		},
+	})
+}
+
+// decryptECB reverses utils.AESEncryptECB with the raw key
+func decryptECB(key []byte, ciphertextB64 string) (string, error) {
+	ciphertext, err := base64.StdEncoding.DecodeString(ciphertextB64)
+	if err != nil {
+		return "", err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	if len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		return "", errors.New("ciphertext is not a multiple of the block size")
+	}
+
+	plaintext := make([]byte, len(ciphertext))
+	for i := 0; i < len(ciphertext); i += aes.BlockSize {
+		block.Decrypt(plaintext[i:i+aes.BlockSize], ciphertext[i:i+aes.BlockSize])
+	}
+
+	padding := int(plaintext[len(plaintext)-1])
+	if padding == 0 || padding > aes.BlockSize || padding > len(plaintext) {
+		return "", errors.New("invalid padding")
+	}
+
+	return string(plaintext[:len(plaintext)-padding]), nil
+}
@@ -0,0 +1,219 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// OnlineUserInfo is returned by adaptor/getOnlineUserInfo
+type OnlineUserInfo struct {
+	PortalOnlineUserInfo *PortalOnlineUserInfo `json:"portalOnlineUserInfo"`
+	OnlineUser           *OnlineUser           `json:"onlineUser"`
+}
+
+// PortalOnlineUserInfo describes the portal side of the current session
+type PortalOnlineUserInfo struct {
+	UserName    string  `json:"userName"`
+	UserID      string  `json:"userId"`
+	Service     string  `json:"service"`
+	UserIP      string  `json:"userIp"`
+	RedirectURL *string `json:"redirectUrl"`
+}
+
+// OnlineUser describes the network side of the current session
+type OnlineUser struct {
+	AuthenticationTime   string `json:"authenticationTime"`
+	NodePhysicalLocation string `json:"nodePhysicalLocation"`
+}
+
+// IsOnline reports whether the portal considers the user logged in.
+// The portal only hands out a redirect URL to users that still need to authenticate.
+func (i *OnlineUserInfo) IsOnline() bool {
+	return i.PortalOnlineUserInfo != nil && i.PortalOnlineUserInfo.RedirectURL == nil
+}
+
+// UnmarshalJSON rejects responses without portalOnlineUserInfo, which carries
+// the online state and must not be mistaken for an online session
+func (i *OnlineUserInfo) UnmarshalJSON(data []byte) error {
+	type plain OnlineUserInfo
+	if err := json.Unmarshal(data, (*plain)(i)); err != nil {
+		return err
+	}
+	if i.PortalOnlineUserInfo == nil {
+		return fmt.Errorf("portalOnlineUserInfo is missing")
+	}
+	return nil
+}
+
+// DisplayName returns the user name, falling back to the user ID
+func (i *OnlineUserInfo) DisplayName() string {
+	if i.PortalOnlineUserInfo == nil {
+		return ""
+	}
+	if i.PortalOnlineUserInfo.UserName != "" {
+		return i.PortalOnlineUserInfo.UserName
+	}
+	return i.PortalOnlineUserInfo.UserID
+}
+
+// AccountInfo is returned by operator/getAccountInfo
+type AccountInfo struct {
+	Name             string          `json:"name"`
+	Service          string          `json:"service"`
+	AllowMab         bool            `json:"allowMab"`
+	NosenseEnable    bool            `json:"nosenseEnable"`
+	GoLink           string          `json:"goLink"`
+	PortalSuccessURL string          `json:"portalSuccessUrl"`
+	Details          []AccountDetail `json:"accountInfo"`
+
+	// Extra holds the fields not covered above
+	Extra map[string]interface{} `json:"-"`
+}
+
+// AccountDetail is a single title/content pair of the account details
+type AccountDetail struct {
+	Title   string `json:"title"`
+	Content string `json:"content"`
+}
+
+// UnmarshalJSON decodes the known account fields and keeps the rest in Extra
+func (a *AccountInfo) UnmarshalJSON(data []byte) error {
+	type plain AccountInfo
+	if err := json.Unmarshal(data, (*plain)(a)); err != nil {
+		return err
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	for _, known := range []string{"name", "service", "allowMab", "nosenseEnable", "goLink", "portalSuccessUrl", "accountInfo"} {
+		delete(fields, known)
+	}
+	a.Extra = fields
+
+	return nil
+}
+
+// Service is a network service (carrier package) offered by the portal
+type Service struct {
+	Name      string `json:"name"`
+	ID        string `json:"id,omitempty"`
+	Available bool   `json:"available"` // False when the portal marks the service as disabled
+	Default   bool   `json:"default"`   // True for the service the portal preselects
+}
+
+// ServiceList is returned by network/serviceSelection
+type ServiceList struct {
+	Services []Service `json:"services"`
+}
+
+// Names returns the service names in portal order
+func (l *ServiceList) Names() []string {
+	names := make([]string, 0, len(l.Services))
+	for _, service := range l.Services {
+		names = append(names, service.Name)
+	}
+	return names
+}
+
+// UnmarshalJSON accepts either a bare array or an object wrapping the array
+// under services, serviceList or data. Entries may be plain names or objects.
+// An object without any of these keys is an error, not an empty list.
+func (l *ServiceList) UnmarshalJSON(data []byte) error {
+	var entries []json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
+		var wrapper map[string]json.RawMessage
+		if err := json.Unmarshal(data, &wrapper); err != nil {
+			return fmt.Errorf("service list is neither an array nor an object")
+		}
+		found := false
+		for _, key := range []string{"services", "serviceList", "data"} {
+			if raw, ok := wrapper[key]; ok {
+				if err := json.Unmarshal(raw, &entries); err != nil {
+					return fmt.Errorf("field %q is not an array: %w", key, err)
+				}
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("service list object has none of services, serviceList or data")
+		}
+	}
+
+	l.Services = make([]Service, 0, len(entries))
+	for i, entry := range entries {
+		service, err := decodeService(entry)
+		if err != nil {
+			return fmt.Errorf("service #%d: %w", i+1, err)
+		}
+		l.Services = append(l.Services, service)
+	}
+
+	return nil
+}
+
+// decodeService decodes one service entry of the service list
+func decodeService(data json.RawMessage) (Service, error) {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		return Service{Name: name, Available: true}, nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return Service{}, fmt.Errorf("unsupported entry %s", string(data))
+	}
+
+	service := Service{Available: true}
+	for _, key := range []string{"name", "serviceName", "service"} {
+		if value, ok := fields[key].(string); ok && value != "" {
+			service.Name = value
+			break
+		}
+	}
+	if service.Name == "" {
+		return Service{}, fmt.Errorf("entry has no name: %s", string(data))
+	}
+	for _, key := range []string{"id", "serviceId", "serviceCode"} {
+		if value, ok := fields[key]; ok && value != nil {
+			service.ID = fmt.Sprint(value)
+			break
+		}
+	}
+	for _, key := range []string{"available", "enable", "enabled"} {
+		if value, ok := fields[key].(bool); ok {
+			service.Available = value
+			break
+		}
+	}
+	if disabled, ok := fields["disabled"].(bool); ok && disabled {
+		service.Available = false
+	}
+	for _, key := range []string{"default", "isDefault", "selected"} {
+		if value, ok := fields[key].(bool); ok {
+			service.Default = value
+			break
+		}
+	}
+
+	return service, nil
+}
+
+// ServiceLoginResult is returned by network/serviceLogin
+type ServiceLoginResult struct {
+	AuthResult  string `json:"authResult"`
+	AuthMessage string `json:"authMessage"`
+}
+
+// OnlineStatus is returned by network/userOnline
+type OnlineStatus struct {
+	Online  bool   `json:"online"`
+	Message string `json:"message"`
+}
+
+// CurrentNode is returned by workFlow/getCurrentNode
+type CurrentNode struct {
+	CurrentNodePath string `json:"currentNodePath"`
+}
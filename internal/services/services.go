@@ -0,0 +1,256 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"ruijie-go/internal/models"
+)
+
+// keywords maps romanised and English spellings onto a fragment of the Chinese
+// service name, so "dianxin" finds "中国电信" whatever the portal calls the package
+var keywords = map[string]string{
+	"xiaoyuanwang":     "校园",
+	"xiaoyuan":         "校园",
+	"xyw":              "校园",
+	"campus":           "校园",
+	"dianxin":          "电信",
+	"zhongguodianxin":  "电信",
+	"dx":               "电信",
+	"telecom":          "电信",
+	"chinatelecom":     "电信",
+	"yidong":           "移动",
+	"zhongguoyidong":   "移动",
+	"yd":               "移动",
+	"mobile":           "移动",
+	"chinamobile":      "移动",
+	"cmcc":             "移动",
+	"liantong":         "联通",
+	"zhongguoliantong": "联通",
+	"lt":               "联通",
+	"unicom":           "联通",
+	"chinaunicom":      "联通",
+}
+
+// minPrefixLength is the shortest input matched as a prefix of a keyword
+const minPrefixLength = 3
+
+// Resolver maps user input onto a service name of the live service list.
+// Input may be a 1-based number, a service name or ID, a user alias, a
+// pinyin/English keyword or an unambiguous part of a name.
+type Resolver struct {
+	Aliases map[string]string // User-defined aliases, keys are case-insensitive
+}
+
+// NewResolver creates a resolver with the given user aliases
+func NewResolver(aliases map[string]string) *Resolver {
+	normalized := make(map[string]string, len(aliases))
+	for alias, target := range aliases {
+		normalized[strings.ToLower(strings.TrimSpace(alias))] = strings.TrimSpace(target)
+	}
+	return &Resolver{Aliases: normalized}
+}
+
+// ResolveService returns the name of the service selected by input.
+// Empty input selects the service the portal marks as default, else the first one.
+func (r *Resolver) ResolveService(services *models.ServiceList, input string) (string, error) {
+	input = strings.TrimSpace(input)
+	if services == nil || len(services.Services) == 0 {
+		if target, ok := r.alias(input); ok {
+			return target, nil
+		}
+		return input, nil
+	}
+
+	if input == "" {
+		for _, service := range services.Services {
+			if service.Default {
+				return service.Name, nil
+			}
+		}
+		return services.Services[0].Name, nil
+	}
+
+	// Aliases may point at anything the resolver understands except another alias
+	if target, ok := r.alias(input); ok {
+		input = target
+	}
+
+	// Numbers follow the portal order of the service list
+	if number, err := strconv.Atoi(input); err == nil {
+		if number < 1 || number > len(services.Services) {
+			return "", fmt.Errorf("service number %d out of range (1-%d)", number, len(services.Services))
+		}
+		return services.Services[number-1].Name, nil
+	}
+
+	for _, service := range services.Services {
+		if strings.EqualFold(service.Name, input) || (service.ID != "" && service.ID == input) {
+			return service.Name, nil
+		}
+	}
+
+	matches := match(services, input)
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("unknown service %q (available: %s)", input, strings.Join(services.Names(), ", "))
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("service %q is ambiguous (matches: %s)", input, strings.Join(matches, ", "))
+	}
+}
+
+// AliasesFor returns the user aliases and keywords that select the named service
+func (r *Resolver) AliasesFor(name string) []string {
+	var aliases []string
+	for alias, target := range r.Aliases {
+		if target == name {
+			aliases = append(aliases, alias)
+		}
+	}
+	for keyword, fragment := range keywords {
+		if len(keyword) >= minPrefixLength && strings.Contains(name, fragment) {
+			aliases = append(aliases, keyword)
+		}
+	}
+	sort.Strings(aliases)
+	return aliases
+}
+
+// alias looks up a user-defined alias
+func (r *Resolver) alias(input string) (string, bool) {
+	if r == nil {
+		return "", false
+	}
+	target, ok := r.Aliases[strings.ToLower(input)]
+	return target, ok
+}
+
+// match returns the names of the services input fuzzily refers to
+func match(services *models.ServiceList, input string) []string {
+	needle := normalize(input)
+	fragments := map[string]bool{}
+	for keyword, fragment := range keywords {
+		if keyword == needle || (len(needle) >= minPrefixLength && strings.HasPrefix(keyword, needle)) {
+			fragments[fragment] = true
+		}
+	}
+
+	var matches []string
+	for _, service := range services.Services {
+		matched := needle != "" && strings.Contains(normalize(service.Name), needle)
+		for fragment := range fragments {
+			matched = matched || strings.Contains(service.Name, fragment)
+		}
+		if matched {
+			matches = append(matches, service.Name)
+		}
+	}
+	return matches
+}
+
+// normalize lowercases input and drops separators so "China-Mobile" equals "chinamobile"
+func normalize(input string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '_', '.':
+			return -1
+		}
+		return r
+	}, strings.ToLower(input))
+}
+
+// cachedServices is one service list of the service cache
+type cachedServices struct {
+	Services  []models.Service `json:"services"`
+	UpdatedAt time.Time        `json:"updatedAt"`
+}
+
+// cacheFile is the on-disk format of the service cache. Lists are kept per
+// portal and account, as accounts may be offered different services.
+type cacheFile struct {
+	Entries map[string]cachedServices `json:"entries"`
+}
+
+// FileCache keeps the last service list fetched from the portal in a JSON file
+type FileCache struct {
+	Path string
+	Key  func() string // Selects the entry of the portal and account in use
+}
+
+// NewFileCache creates a service cache backed by the given file, key is
+// called on every access so it may depend on credentials entered later
+func NewFileCache(path string, key func() string) *FileCache {
+	return &FileCache{Path: path, Key: key}
+}
+
+// CacheKey returns the cache entry of an account on a portal
+func CacheKey(portalURL, username string) string {
+	return strings.TrimRight(portalURL, "/") + "#" + username
+}
+
+// Load reads the cached service list of the current entry, a missing file or entry yields a nil list
+func (c *FileCache) Load() (*models.ServiceList, error) {
+	file, err := c.read()
+	if err != nil {
+		return nil, err
+	}
+
+	entry, ok := file.Entries[c.Key()]
+	if !ok {
+		return nil, nil
+	}
+	return &models.ServiceList{Services: entry.Services}, nil
+}
+
+// SaveServices replaces the cached service list of the current entry
+func (c *FileCache) SaveServices(services *models.ServiceList) error {
+	file, err := c.read()
+	if err != nil {
+		// A broken cache is replaced rather than blocking every save
+		file = &cacheFile{}
+	}
+	if file.Entries == nil {
+		file.Entries = map[string]cachedServices{}
+	}
+	file.Entries[c.Key()] = cachedServices{Services: services.Services, UpdatedAt: time.Now()}
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode service cache: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.Path), 0700); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	if err := os.WriteFile(c.Path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write service cache: %w", err)
+	}
+
+	return nil
+}
+
+// read parses the cache file, a missing file yields an empty cache
+func (c *FileCache) read() (*cacheFile, error) {
+	data, err := os.ReadFile(c.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &cacheFile{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service cache: %w", err)
+	}
+
+	var file cacheFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse service cache: %w", err)
+	}
+	return &file, nil
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"ruijie-go/internal/models"
+)
+
+// ysuServices is the service list of the YSU portal, in portal order
+var ysuServices = &models.ServiceList{Services: []models.Service{
+	{Name: "校园网", ID: "svc-campus", Available: true},
+	{Name: "中国联通", Available: true},
+	{Name: "中国电信", Available: true, Default: true},
+	{Name: "中国移动", Available: true},
+}}
+
+func TestResolveService(t *testing.T) {
+	resolver := NewResolver(map[string]string{" Home ": "dx", "work": "2", "lab": "中国移动"})
+
+	tests := []struct {
+		input string
+		want  string // Empty when an error is expected
+		err   string // Part of the expected error
+	}{
+		{input: "", want: "中国电信"},
+		{input: "1", want: "校园网"},
+		{input: "4", want: "中国移动"},
+		{input: "0", err: "out of range"},
+		{input: "5", err: "out of range"},
+		{input: "中国移动", want: "中国移动"},
+		{input: "svc-campus", want: "校园网"},
+		{input: "dianxin", want: "中国电信"},
+		{input: "DianXin", want: "中国电信"},
+		{input: "China-Mobile", want: "中国移动"},
+		{input: "unicom", want: "中国联通"},
+		{input: "dx", want: "中国电信"},
+		{input: "dian", want: "中国电信"}, // Prefix of dianxin
+		{input: "xia", want: "校园网"},   // Prefix of xiaoyuan and xiaoyuanwang
+		{input: "di", err: "unknown service"},
+		{input: "zhong", err: "ambiguous"},
+		{input: "中国", err: "ambiguous"},
+		{input: "网", want: "校园网"},
+		{input: "home", want: "中国电信"},
+		{input: "WORK", want: "中国联通"},
+		{input: "lab", want: "中国移动"},
+		{input: "foo", err: "unknown service"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := resolver.ResolveService(ysuServices, tt.input)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("ResolveService(%q) = %q, %v, want an error containing %q", tt.input, got, err, tt.err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("ResolveService(%q) = %q, %v, want %q", tt.input, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveServiceWithoutList(t *testing.T) {
+	resolver := NewResolver(map[string]string{"dx": "中国电信"})
+
+	for input, want := range map[string]string{"dx": "中国电信", "校园网": "校园网", "dianxin": "dianxin"} {
+		if got, err := resolver.ResolveService(nil, input); err != nil || got != want {
+			t.Errorf("ResolveService(nil, %q) = %q, %v, want %q", input, got, err, want)
+		}
+	}
+}
+
+func TestAliasesFor(t *testing.T) {
+	resolver := NewResolver(map[string]string{"home": "中国电信"})
+
+	want := []string{"chinatelecom", "dianxin", "home", "telecom", "zhongguodianxin"}
+	if got := resolver.AliasesFor("中国电信"); !reflect.DeepEqual(got, want) {
+		t.Errorf("AliasesFor = %v, want %v", got, want)
+	}
+}
+
+func TestFileCacheKeysByPortalAndUser(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "services.json")
+	key := ""
+	cache := NewFileCache(path, func() string { return key })
+
+	lists := map[string]*models.ServiceList{
+		CacheKey("https://auth1.ysu.edu.cn/", "alice"): {Services: []models.Service{{Name: "校园网"}}},
+		CacheKey("https://auth1.ysu.edu.cn", "bob"):    {Services: []models.Service{{Name: "中国电信"}}},
+		CacheKey("http://127.0.0.1:8080", "alice"):     {Services: []models.Service{{Name: "中国移动"}}},
+	}
+	if len(lists) != 3 {
+		t.Fatalf("cache keys collide: %v", lists)
+	}
+	for key = range lists {
+		if err := cache.SaveServices(lists[key]); err != nil {
+			t.Fatalf("SaveServices(%s): %v", key, err)
+		}
+	}
+
+	for key = range lists {
+		got, err := cache.Load()
+		if err != nil {
+			t.Fatalf("Load(%s): %v", key, err)
+		}
+		if got == nil || !reflect.DeepEqual(got.Names(), lists[key].Names()) {
+			t.Errorf("Load(%s) = %v, want %v", key, got, lists[key].Names())
+		}
+	}
+
+	key = CacheKey("https://auth1.ysu.edu.cn", "carol")
+	if got, err := cache.Load(); got != nil || err != nil {
+		t.Errorf("Load of an unknown account = %v, %v, want no list", got, err)
+	}
+}
+
+func TestFileCacheReplacesBrokenFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "services.json")
+	if err := os.WriteFile(path, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cache := NewFileCache(path, func() string { return CacheKey("https://portal", "alice") })
+
+	if _, err := cache.Load(); err == nil {
+		t.Error("Load of a broken cache succeeded")
+	}
+	if err := cache.SaveServices(ysuServices); err != nil {
+		t.Fatalf("SaveServices over a broken cache: %v", err)
+	}
+	if got, err := cache.Load(); err != nil || got == nil || len(got.Services) != len(ysuServices.Services) {
+		t.Errorf("Load after saving = %v, %v, want the saved list", got, err)
+	}
+}
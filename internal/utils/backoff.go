@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Backoff computes exponentially growing delays with random jitter
+type Backoff struct {
+	Base   time.Duration // delay before the first retry
+	Max    time.Duration // upper bound for a single delay
+	Jitter float64       // fraction of the delay that is randomised (0..1)
+
+	attempt int
+}
+
+// Next returns the delay to wait before the next attempt and advances the backoff
+func (b *Backoff) Next() time.Duration {
+	delay := b.Base
+	for i := 0; i < b.attempt && delay < b.Max; i++ {
+		delay *= 2
+	}
+	if b.Max > 0 && delay > b.Max {
+		delay = b.Max
+	}
+	b.attempt++
+
+	if b.Jitter > 0 {
+		spread := float64(delay) * b.Jitter
+		delay = time.Duration(float64(delay) - spread + rand.Float64()*2*spread)
+	}
+	if delay < 0 {
+		delay = 0
+	}
+
+	return delay
+}
+
+// Reset restarts the backoff from the base delay
+func (b *Backoff) Reset() {
+	b.attempt = 0
+}
@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffDoublesUpToMax(t *testing.T) {
+	b := Backoff{Base: 100 * time.Millisecond, Max: 500 * time.Millisecond}
+
+	want := []time.Duration{100, 200, 400, 500, 500}
+	for i, w := range want {
+		if got := b.Next(); got != w*time.Millisecond {
+			t.Errorf("delay %d = %v, want %v", i+1, got, w*time.Millisecond)
+		}
+	}
+
+	b.Reset()
+	if got := b.Next(); got != 100*time.Millisecond {
+		t.Errorf("delay after Reset = %v, want 100ms", got)
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	b := Backoff{Base: time.Second, Max: time.Second, Jitter: 0.2}
+
+	for i := 0; i < 100; i++ {
+		if got := b.Next(); got < 800*time.Millisecond || got > 1200*time.Millisecond {
+			t.Fatalf("delay %v is outside 1s ± 20%%", got)
+		}
+	}
+}
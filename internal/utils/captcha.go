@@ -2,10 +2,14 @@ package utils
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"image"
 	"image/color"
 	"io"
+	"net/http"
 	"os"
 	"os/exec"
 	"runtime"
@@ -13,6 +17,7 @@ import (
 	"time"
 
 	_ "image/gif"
+	_ "image/jpeg"
 	_ "image/png"
 )
 
@@ -75,14 +80,11 @@ func ImageToASCII(imageData io.Reader, width int, charSet string) (string, error
 	return result.String(), nil
 }
 
-// SaveCaptchaToFile saves captcha image data to a temporary file
-func SaveCaptchaToFile(imageData []byte) (string, error) {
-	// Generate unique filename
-	timestamp := time.Now().UnixNano()
-	filename := fmt.Sprintf("captcha_%d.jpg", timestamp)
-
-	// Create temporary file
-	file, err := os.Create(filename)
+// SaveCaptchaToFile saves captcha image data to a temporary file in dir, the
+// system temp directory if dir is empty. The directory must already exist.
+func SaveCaptchaToFile(dir string, imageData []byte) (string, error) {
+	// Create temporary file with a unique name
+	file, err := os.CreateTemp(dir, "captcha-*.jpg")
 	if err != nil {
 		return "", fmt.Errorf("failed to create captcha file: %w", err)
 	}
@@ -94,7 +96,7 @@ func SaveCaptchaToFile(imageData []byte) (string, error) {
 		return "", fmt.Errorf("failed to write captcha data: %w", err)
 	}
 
-	return filename, nil
+	return file.Name(), nil
 }
 
 // OpenImageFile attempts to open an image file with the default system application
@@ -115,71 +117,183 @@ func OpenImageFile(filename string) error {
 	return cmd.Start()
 }
 
-// DisplayCaptcha displays captcha according to the specified mode and prompts for input
-func DisplayCaptcha(imageData []byte, mode CaptchaDisplayMode) (string, error) {
-	fmt.Println(strings.Repeat("=", 60))
-	fmt.Println("验证码显示")
-	fmt.Println(strings.Repeat("=", 60))
-
-	var captchaFile string
-	var err error
+// DisplayCaptcha displays captcha according to the specified mode and prompts
+// for input, image files are saved in dir. Everything is written to stderr so
+// structured output on stdout stays parseable, and the prompt gives up once
+// ctx is done.
+func DisplayCaptcha(ctx context.Context, imageData []byte, mode CaptchaDisplayMode, dir string) (string, error) {
+	out := os.Stderr
+	fmt.Fprintln(out, strings.Repeat("=", 60))
+	fmt.Fprintln(out, "验证码显示")
+	fmt.Fprintln(out, strings.Repeat("=", 60))
 
 	// Display ASCII version if requested
 	if mode == DisplayASCII || mode == DisplayBoth {
-		fmt.Println("\nASCII 艺术版本:")
-		fmt.Println(strings.Repeat("-", 40))
+		fmt.Fprintln(out, "\nASCII 艺术版本:")
+		fmt.Fprintln(out, strings.Repeat("-", 40))
 
 		asciiArt, err := ImageToASCII(strings.NewReader(string(imageData)), 60, "standard")
 		if err != nil {
-			fmt.Printf("ASCII转换失败: %v\n", err)
+			fmt.Fprintf(out, "ASCII转换失败: %v\n", err)
 		} else {
-			fmt.Print(asciiArt)
+			fmt.Fprint(out, asciiArt)
 		}
-		fmt.Println(strings.Repeat("-", 40))
+		fmt.Fprintln(out, strings.Repeat("-", 40))
 	}
 
 	// Save to file if requested
 	if mode == DisplayFile || mode == DisplayBoth {
-		captchaFile, err = SaveCaptchaToFile(imageData)
+		captchaFile, err := SaveCaptchaToFile(dir, imageData)
 		if err != nil {
-			fmt.Printf("保存验证码文件失败: %v\n", err)
+			fmt.Fprintf(out, "保存验证码文件失败: %v\n", err)
 		} else {
-			fmt.Printf("\n验证码已保存到文件: %s\n", captchaFile)
+			fmt.Fprintf(out, "\n验证码已保存到文件: %s\n", captchaFile)
+
+			// Clean up captcha file once answered, cancelled or timed out
+			defer func() {
+				if err := os.Remove(captchaFile); err != nil {
+					fmt.Fprintf(out, "清理验证码文件失败: %v\n", err)
+				} else {
+					fmt.Fprintf(out, "验证码文件已清理: %s\n", captchaFile)
+				}
+			}()
 
 			// Try to open the image automatically
 			if err := OpenImageFile(captchaFile); err != nil {
-				fmt.Printf("无法自动打开图片，请手动查看: %s\n", captchaFile)
+				fmt.Fprintf(out, "无法自动打开图片，请手动查看: %s\n", captchaFile)
 			} else {
-				fmt.Println("验证码图片已自动打开")
+				fmt.Fprintln(out, "验证码图片已自动打开")
 			}
 		}
 	}
 
-	fmt.Println(strings.Repeat("=", 60))
+	fmt.Fprintln(out, strings.Repeat("=", 60))
 
-	// Get user input
-	fmt.Print("请输入验证码: ")
-	reader := bufio.NewReader(os.Stdin)
-	captcha, err := reader.ReadString('\n')
-	if err != nil {
-		return "", fmt.Errorf("failed to read captcha input: %w", err)
+	// Get user input, the read is abandoned when ctx is done
+	fmt.Fprint(out, "请输入验证码: ")
+	type result struct {
+		line string
+		err  error
+	}
+	input := make(chan result, 1)
+	go func() {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		input <- result{line, err}
+	}()
+
+	var captcha string
+	select {
+	case <-ctx.Done():
+		fmt.Fprintln(out)
+		return "", fmt.Errorf("captcha input cancelled: %w", ctx.Err())
+	case res := <-input:
+		if res.err != nil {
+			return "", fmt.Errorf("failed to read captcha input: %w", res.err)
+		}
+		captcha = strings.TrimSpace(res.line)
 	}
 
-	captcha = strings.TrimSpace(captcha)
 	if captcha == "" {
-		fmt.Println("警告：验证码为空")
+		fmt.Fprintln(out, "警告：验证码为空")
 	} else {
-		fmt.Printf("验证码输入完成: %s\n", captcha)
+		fmt.Fprintf(out, "验证码输入完成: %s\n", captcha)
 	}
 
-	// Clean up captcha file immediately
-	if captchaFile != "" {
-		if err := os.Remove(captchaFile); err != nil {
-			fmt.Printf("清理验证码文件失败: %v\n", err)
-		} else {
-			fmt.Printf("验证码文件已清理: %s\n", captchaFile)
+	return captcha, nil
+}
+
+// InteractiveCaptchaSolver shows the captcha in the terminal and asks the user for the code
+type InteractiveCaptchaSolver struct {
+	Mode CaptchaDisplayMode
+	Dir  string // Directory of captcha image files, the system temp directory if empty
+}
+
+// SolveCaptcha implements client.CaptchaSolver
+func (s InteractiveCaptchaSolver) SolveCaptcha(ctx context.Context, imageData []byte) (string, error) {
+	return DisplayCaptcha(ctx, imageData, s.Mode, s.Dir)
+}
+
+// CommandCaptchaSolver pipes the captcha image into an external command and
+// reads the code from the first line of its output
+type CommandCaptchaSolver struct {
+	Command string
+}
+
+// SolveCaptcha implements client.CaptchaSolver
+func (s CommandCaptchaSolver) SolveCaptcha(ctx context.Context, imageData []byte) (string, error) {
+	args := strings.Fields(s.Command)
+	if len(args) == 0 {
+		return "", fmt.Errorf("captcha command is not configured")
+	}
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = bytes.NewReader(imageData)
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("captcha command failed: %w", err)
+	}
+
+	code, _, _ := strings.Cut(string(output), "\n")
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return "", fmt.Errorf("captcha command returned no code")
+	}
+
+	return code, nil
+}
+
+// HTTPCaptchaSolver posts the captcha image to a solver service. The service
+// answers with the code as plain text or as a JSON object with a "code" field.
+type HTTPCaptchaSolver struct {
+	URL    string
+	Client *http.Client
+}
+
+// SolveCaptcha implements client.CaptchaSolver
+func (s HTTPCaptchaSolver) SolveCaptcha(ctx context.Context, imageData []byte) (string, error) {
+	if s.URL == "" {
+		return "", fmt.Errorf("captcha solver URL is not configured")
+	}
+
+	httpClient := s.Client
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(imageData))
+	if err != nil {
+		return "", fmt.Errorf("failed to create captcha solver request: %w", err)
+	}
+	req.Header.Set("Content-Type", http.DetectContentType(imageData))
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("captcha solver request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return "", fmt.Errorf("failed to read captcha solver response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("captcha solver returned %s", resp.Status)
+	}
+
+	code := strings.TrimSpace(string(body))
+	if strings.HasPrefix(code, "{") {
+		var result struct {
+			Code string `json:"code"`
+		}
+		if err := json.Unmarshal(body, &result); err != nil {
+			return "", fmt.Errorf("failed to parse captcha solver response: %w", err)
 		}
+		code = strings.TrimSpace(result.Code)
+	}
+	if code == "" {
+		return "", fmt.Errorf("captcha solver returned no code")
 	}
 
-	return captcha, nil
+	return code, nil
 }
@@ -2,54 +2,44 @@ package utils
 
 import (
 	"fmt"
+	"sort"
 	"strings"
+
+	"ruijie-go/internal/models"
+	"ruijie-go/internal/services"
 )
 
 // PrintStatusInfo prints user status information
-func PrintStatusInfo(userInfo map[string]interface{}) {
-	portalInfo, _ := userInfo["portalOnlineUserInfo"].(map[string]interface{})
-	onlineInfo, _ := userInfo["onlineUser"].(map[string]interface{})
-
-	var username string
-	if portalInfo != nil {
-		if name, ok := portalInfo["userName"].(string); ok && name != "" {
-			username = name
-		} else if userID, ok := portalInfo["userId"].(string); ok {
-			username = userID
-		}
+func PrintStatusInfo(userInfo *models.OnlineUserInfo) {
+	username := userInfo.DisplayName()
+	if username == "" {
+		fmt.Println("Status information unavailable")
+		return
 	}
 
-	if username != "" {
-		fmt.Printf("Online: %s", username)
+	portalInfo := userInfo.PortalOnlineUserInfo
+	fmt.Printf("Online: %s", username)
+	if portalInfo.Service != "" {
+		fmt.Printf(" (%s)", portalInfo.Service)
+	}
+	fmt.Println()
 
-		if portalInfo != nil {
-			if service, ok := portalInfo["service"].(string); ok && service != "" {
-				fmt.Printf(" (%s)", service)
-			}
-		}
-		fmt.Println()
+	if portalInfo.UserIP != "" {
+		fmt.Printf("IP: %s\n", portalInfo.UserIP)
+	}
 
-		if portalInfo != nil {
-			if userIP, ok := portalInfo["userIp"].(string); ok && userIP != "" {
-				fmt.Printf("IP: %s\n", userIP)
-			}
+	if onlineInfo := userInfo.OnlineUser; onlineInfo != nil {
+		if onlineInfo.AuthenticationTime != "" {
+			fmt.Printf("Login Time: %s\n", onlineInfo.AuthenticationTime)
 		}
-
-		if onlineInfo != nil {
-			if loginTime, ok := onlineInfo["authenticationTime"].(string); ok && loginTime != "" {
-				fmt.Printf("Login Time: %s\n", loginTime)
-			}
-			if location, ok := onlineInfo["nodePhysicalLocation"].(string); ok && location != "" {
-				fmt.Printf("Location: %s\n", location)
-			}
+		if onlineInfo.NodePhysicalLocation != "" {
+			fmt.Printf("Location: %s\n", onlineInfo.NodePhysicalLocation)
 		}
-	} else {
-		fmt.Println("Status information unavailable")
 	}
 }
 
 // PrintAccountInfo prints account information
-func PrintAccountInfo(accountInfo map[string]interface{}) {
+func PrintAccountInfo(accountInfo *models.AccountInfo) {
 	if accountInfo == nil {
 		fmt.Println("Account information unavailable")
 		return
@@ -57,210 +47,125 @@ func PrintAccountInfo(accountInfo map[string]interface{}) {
 
 	fmt.Println("Account Information:")
 
-	// Basic fields mapping
-	basicFields := map[string]string{
-		"name":          "Name",
-		"service":       "Service",
-		"allowMab":      "MAB Allowed",
-		"nosenseEnable": "Nosense Enabled",
-		"goLink":        "Portal URL",
-	}
-
 	// Display basic information
-	for key, label := range basicFields {
-		if value, exists := accountInfo[key]; exists && value != nil {
-			switch v := value.(type) {
-			case bool:
-				if v {
-					fmt.Printf("  %s: Yes\n", label)
-				} else {
-					fmt.Printf("  %s: No\n", label)
-				}
-			case string:
-				if v != "" {
-					fmt.Printf("  %s: %s\n", label, v)
-				}
-			default:
-				fmt.Printf("  %s: %v\n", label, v)
-			}
-		}
+	if accountInfo.Name != "" {
+		fmt.Printf("  Name: %s\n", accountInfo.Name)
+	}
+	if accountInfo.Service != "" {
+		fmt.Printf("  Service: %s\n", accountInfo.Service)
+	}
+	fmt.Printf("  MAB Allowed: %s\n", yesNo(accountInfo.AllowMab))
+	fmt.Printf("  Nosense Enabled: %s\n", yesNo(accountInfo.NosenseEnable))
+	if accountInfo.GoLink != "" {
+		fmt.Printf("  Portal URL: %s\n", accountInfo.GoLink)
 	}
 
 	// Display account details if available
-	if accountInfoList, ok := accountInfo["accountInfo"].([]interface{}); ok {
+	if len(accountInfo.Details) > 0 {
 		fmt.Println("  Details:")
-		for _, detail := range accountInfoList {
-			if detailMap, ok := detail.(map[string]interface{}); ok {
-				title, titleOk := detailMap["title"].(string)
-				content, contentOk := detailMap["content"].(string)
-				if titleOk && contentOk && title != "" && content != "" {
-					fmt.Printf("    %s: %s\n", title, content)
-				}
+		for _, detail := range accountInfo.Details {
+			if detail.Title != "" && detail.Content != "" {
+				fmt.Printf("    %s: %s\n", detail.Title, detail.Content)
 			}
 		}
 	}
 
-	// Display other fields (excluding already processed and unimportant ones)
-	excludedFields := map[string]bool{
-		"name":             true,
-		"service":          true,
-		"allowMab":         true,
-		"nosenseEnable":    true,
-		"goLink":           true,
-		"accountInfo":      true,
-		"portalSuccessUrl": true,
+	// Display other fields in a stable order
+	keys := make([]string, 0, len(accountInfo.Extra))
+	for key := range accountInfo.Extra {
+		keys = append(keys, key)
 	}
+	sort.Strings(keys)
 
-	for key, value := range accountInfo {
-		if !excludedFields[key] && value != nil && value != "" {
+	for _, key := range keys {
+		if value := accountInfo.Extra[key]; value != nil && value != "" {
 			fmt.Printf("  %s: %v\n", key, value)
 		}
 	}
 }
 
-// PrintServicesList prints available services list
-func PrintServicesList(servicesData interface{}) {
-	if servicesData == nil {
+// yesNo formats a boolean for display
+func yesNo(value bool) string {
+	if value {
+		return "Yes"
+	}
+	return "No"
+}
+
+// PrintServicesList prints available services list with the aliases selecting them
+func PrintServicesList(services *models.ServiceList, resolver *services.Resolver) {
+	if services == nil {
 		fmt.Println("No services available")
 		return
 	}
 
 	fmt.Println("Available Services:")
 
-	var services []interface{}
-
-	// Extract services from different possible structures
-	switch data := servicesData.(type) {
-	case map[string]interface{}:
-		// Try different possible field names
-		if serviceList, ok := data["services"].([]interface{}); ok {
-			services = serviceList
-		} else if serviceList, ok := data["serviceList"].([]interface{}); ok {
-			services = serviceList
-		} else if serviceList, ok := data["data"].([]interface{}); ok {
-			services = serviceList
-		} else {
-			// Look for any array field
-			for _, value := range data {
-				if serviceList, ok := value.([]interface{}); ok && len(serviceList) > 0 {
-					services = serviceList
-					break
-				}
-			}
-		}
-	case []interface{}:
-		services = data
-	}
-
-	if len(services) == 0 {
+	if len(services.Services) == 0 {
 		fmt.Println("  No services found in response")
 		return
 	}
 
 	// Display services list
-	for i, service := range services {
-		switch s := service.(type) {
-		case string:
-			fmt.Printf("  %d. %s\n", i+1, s)
-		case map[string]interface{}:
-			serviceName := ""
-			if name, ok := s["name"].(string); ok {
-				serviceName = name
-			} else if name, ok := s["serviceName"].(string); ok {
-				serviceName = name
-			} else if name, ok := s["service"].(string); ok {
-				serviceName = name
-			} else {
-				serviceName = fmt.Sprintf("%v", s)
+	for i, service := range services.Services {
+		fmt.Printf("  %d. %s", i+1, service.Name)
+		if service.ID != "" {
+			fmt.Printf(" (id: %s)", service.ID)
+		}
+		if service.Default {
+			fmt.Print(" [default]")
+		}
+		if !service.Available {
+			fmt.Print(" [unavailable]")
+		}
+		if resolver != nil {
+			if aliases := resolver.AliasesFor(service.Name); len(aliases) > 0 {
+				fmt.Printf(" - aliases: %s", strings.Join(aliases, ", "))
 			}
-			fmt.Printf("  %d. %s\n", i+1, serviceName)
-		default:
-			fmt.Printf("  %d. %v\n", i+1, service)
+		}
+		fmt.Println()
+	}
+}
+
+// PrintDoctorReport prints one line per diagnostic check with the hint below failures and warnings
+func PrintDoctorReport(report DoctorReport) {
+	fmt.Printf("Checking the way to %s\n\n", report.Portal)
+
+	width := 0
+	for _, check := range report.Checks {
+		width = max(width, len(check.Name))
+	}
+	for _, check := range report.Checks {
+		fmt.Printf("[%s] %-*s  %s\n", strings.ToUpper(check.Status), width, check.Name, check.Detail)
+		if check.Hint != "" {
+			fmt.Printf("       %-*s  -> %s\n", width, "", check.Hint)
 		}
 	}
 
-	// Display quick selection mappings
-	fmt.Println("\nQuick selection (for non-Chinese terminals):")
-	fmt.Println("  campus or 1 -> 校园网")
-	fmt.Println("  unicom or 2 -> 中国联通")
-	fmt.Println("  telecom or 3 -> 中国电信")
-	fmt.Println("  mobile or 4 -> 中国移动")
+	fmt.Println()
+	if report.OK {
+		fmt.Println("No problems found")
+	} else {
+		fmt.Println("Some checks failed, see the hints above")
+	}
 }
 
 // InteractiveServiceSelection handles interactive service selection
-func InteractiveServiceSelection(servicesData interface{}) (string, error) {
-	PrintServicesList(servicesData)
+func InteractiveServiceSelection(services *models.ServiceList, resolver *services.Resolver) (string, error) {
+	PrintServicesList(services, resolver)
 
-	fmt.Print("\nPlease select a service (number/name/alias): ")
+	fmt.Print("\nPlease select a service (number/name/alias, empty for default): ")
 	var choice string
 	fmt.Scanln(&choice)
 	choice = strings.TrimSpace(choice)
 
-	// If it's a number selection
-	if len(choice) > 0 && choice[0] >= '1' && choice[0] <= '9' {
-		choiceNum := int(choice[0] - '0')
-
-		// From predefined mapping
-		if choiceNum >= 1 && choiceNum <= 4 {
-			serviceNames := []string{"校园网", "中国联通", "中国电信", "中国移动"}
-			return serviceNames[choiceNum-1], nil
-		}
-
-		// From actual services list
-		var services []interface{}
-		switch data := servicesData.(type) {
-		case map[string]interface{}:
-			for _, value := range data {
-				if serviceList, ok := value.([]interface{}); ok && len(serviceList) > 0 {
-					services = serviceList
-					break
-				}
-			}
-		case []interface{}:
-			services = data
-		}
-
-		if choiceNum >= 1 && choiceNum <= len(services) {
-			service := services[choiceNum-1]
-			switch s := service.(type) {
-			case string:
-				return s, nil
-			case map[string]interface{}:
-				if name, ok := s["name"].(string); ok {
-					return name, nil
-				} else if name, ok := s["serviceName"].(string); ok {
-					return name, nil
-				} else if name, ok := s["service"].(string); ok {
-					return name, nil
-				}
-				return fmt.Sprintf("%v", s), nil
-			default:
-				return fmt.Sprintf("%v", service), nil
-			}
-		}
-	}
-
-	// Use service mapping for aliases
-	serviceMapping := map[string]string{
-		"campus":  "校园网",
-		"unicom":  "中国联通",
-		"telecom": "中国电信",
-		"mobile":  "中国移动",
-		"1":       "校园网",
-		"2":       "中国联通",
-		"3":       "中国电信",
-		"4":       "中国移动",
+	selected, err := resolver.ResolveService(services, choice)
+	if err != nil {
+		return "", err
 	}
-
-	if mapped, exists := serviceMapping[strings.ToLower(choice)]; exists {
-		return mapped, nil
-	}
-
-	// Return original choice if no mapping found
 	if choice == "" {
-		fmt.Println("Selection cancelled, using default service: 校园网")
-		return "校园网", nil
+		fmt.Printf("Using default service: %s\n", selected)
 	}
 
-	return choice, nil
+	return selected, nil
 }
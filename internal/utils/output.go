@@ -0,0 +1,176 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"ruijie-go/internal/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats supported by the --output flag
+const (
+	OutputText = "text"
+	OutputJSON = "json"
+	OutputYAML = "yaml"
+)
+
+// StatusReport is the machine-readable result of the status command.
+// Every field is always present, strings are empty when the portal does not report them.
+type StatusReport struct {
+	Online    bool   `json:"online" yaml:"online"`
+	Username  string `json:"username" yaml:"username"`
+	Service   string `json:"service" yaml:"service"`
+	IP        string `json:"ip" yaml:"ip"`
+	LoginTime string `json:"login_time" yaml:"login_time"`
+	Location  string `json:"location" yaml:"location"`
+}
+
+// AccountReport is the machine-readable account information
+type AccountReport struct {
+	Name           string                 `json:"name" yaml:"name"`
+	Service        string                 `json:"service" yaml:"service"`
+	MabAllowed     bool                   `json:"mab_allowed" yaml:"mab_allowed"`
+	NosenseEnabled bool                   `json:"nosense_enabled" yaml:"nosense_enabled"`
+	PortalURL      string                 `json:"portal_url" yaml:"portal_url"`
+	Details        []AccountDetailReport  `json:"details" yaml:"details"`
+	Extra          map[string]interface{} `json:"extra" yaml:"extra"`
+}
+
+// AccountDetailReport is one title/content pair of the account details
+type AccountDetailReport struct {
+	Title   string `json:"title" yaml:"title"`
+	Content string `json:"content" yaml:"content"`
+}
+
+// InfoReport is the machine-readable result of the info command
+type InfoReport struct {
+	Status  StatusReport  `json:"status" yaml:"status"`
+	Account AccountReport `json:"account" yaml:"account"`
+}
+
+// ServicesReport is the machine-readable service list
+type ServicesReport struct {
+	Services []ServiceReport `json:"services" yaml:"services"`
+}
+
+// ServiceReport describes one service, Index is the 1-based number used for selection
+type ServiceReport struct {
+	Index     int    `json:"index" yaml:"index"`
+	Name      string `json:"name" yaml:"name"`
+	ID        string `json:"id" yaml:"id"`
+	Available bool   `json:"available" yaml:"available"`
+	Default   bool   `json:"default" yaml:"default"`
+}
+
+// DoctorReport is the machine-readable result of the doctor command, OK is false if any check failed
+type DoctorReport struct {
+	Portal string        `json:"portal" yaml:"portal"`
+	OK     bool          `json:"ok" yaml:"ok"`
+	Checks []CheckReport `json:"checks" yaml:"checks"`
+}
+
+// CheckReport is one diagnostic check, Status is pass, warn, fail or skip
+type CheckReport struct {
+	Name   string `json:"name" yaml:"name"`
+	Status string `json:"status" yaml:"status"`
+	Detail string `json:"detail" yaml:"detail"`
+	Hint   string `json:"hint" yaml:"hint"`
+}
+
+// NewStatusReport builds a status report from the online user information
+func NewStatusReport(online bool, userInfo *models.OnlineUserInfo) StatusReport {
+	report := StatusReport{Online: online}
+	if !online || userInfo == nil {
+		return report
+	}
+
+	report.Username = userInfo.DisplayName()
+	if portalInfo := userInfo.PortalOnlineUserInfo; portalInfo != nil {
+		report.Service = portalInfo.Service
+		report.IP = portalInfo.UserIP
+	}
+	if onlineInfo := userInfo.OnlineUser; onlineInfo != nil {
+		report.LoginTime = onlineInfo.AuthenticationTime
+		report.Location = onlineInfo.NodePhysicalLocation
+	}
+
+	return report
+}
+
+// NewAccountReport builds an account report from the account information
+func NewAccountReport(accountInfo *models.AccountInfo) AccountReport {
+	report := AccountReport{
+		Details: []AccountDetailReport{},
+		Extra:   map[string]interface{}{},
+	}
+	if accountInfo == nil {
+		return report
+	}
+
+	report.Name = accountInfo.Name
+	report.Service = accountInfo.Service
+	report.MabAllowed = accountInfo.AllowMab
+	report.NosenseEnabled = accountInfo.NosenseEnable
+	report.PortalURL = accountInfo.GoLink
+	for _, detail := range accountInfo.Details {
+		report.Details = append(report.Details, AccountDetailReport{Title: detail.Title, Content: detail.Content})
+	}
+	for key, value := range accountInfo.Extra {
+		report.Extra[key] = value
+	}
+
+	return report
+}
+
+// NewServicesReport builds a service list report
+func NewServicesReport(services *models.ServiceList) ServicesReport {
+	report := ServicesReport{Services: []ServiceReport{}}
+	if services == nil {
+		return report
+	}
+
+	for i, service := range services.Services {
+		report.Services = append(report.Services, ServiceReport{
+			Index:     i + 1,
+			Name:      service.Name,
+			ID:        service.ID,
+			Available: service.Available,
+			Default:   service.Default,
+		})
+	}
+
+	return report
+}
+
+// ValidateOutputFormat checks the value of the --output flag
+func ValidateOutputFormat(format string) error {
+	switch format {
+	case OutputText, OutputJSON, OutputYAML:
+		return nil
+	default:
+		return fmt.Errorf("unknown output format %q (expected text, json or yaml)", format)
+	}
+}
+
+// WriteOutput encodes a report as a JSON or YAML document
+func WriteOutput(w io.Writer, format string, report interface{}) error {
+	switch format {
+	case OutputJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		return encoder.Encode(report)
+	case OutputYAML:
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(report); err != nil {
+			return err
+		}
+		return encoder.Close()
+	default:
+		return fmt.Errorf("output format %q cannot encode documents", format)
+	}
+}
@@ -0,0 +1,38 @@
+package vault
+
+import (
+	"errors"
+	"os"
+	"os/user"
+	"strings"
+)
+
+// machineIDFiles hold a stable per-installation ID on Linux
+var machineIDFiles = []string{"/etc/machine-id", "/var/lib/dbus/machine-id"}
+
+// machineSecret identifies this machine and user. A vault locked with it
+// cannot be opened after copying it elsewhere, but it does not protect
+// against other programs running as the same user.
+func machineSecret() (string, error) {
+	var id string
+	for _, path := range machineIDFiles {
+		if data, err := os.ReadFile(path); err == nil {
+			if id = strings.TrimSpace(string(data)); id != "" {
+				break
+			}
+		}
+	}
+	if id == "" {
+		hostname, err := os.Hostname()
+		if err != nil || hostname == "" {
+			return "", errors.New("cannot identify this machine for a machine-bound vault, use a passphrase")
+		}
+		id = hostname
+	}
+
+	account := ""
+	if current, err := user.Current(); err == nil {
+		account = current.Uid
+	}
+	return "ruijie-go machine key " + id + " " + account, nil
+}
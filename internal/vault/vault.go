@@ -0,0 +1,286 @@
+// Package vault stores portal credentials in an encrypted file. The file is
+// encrypted with AES-256-GCM under a key derived with PBKDF2-SHA256 from a
+// passphrase or from the identity of the machine.
+package vault
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Key sources a vault can be locked with
+const (
+	KeyPassphrase = "passphrase" // Key derived from a passphrase entered by the user
+	KeyMachine    = "machine"    // Key derived from the machine ID and user, for unattended use
+)
+
+// Current file format
+const (
+	formatVersion = 1
+	kdfName       = "pbkdf2-sha256"
+	kdfIterations = 600000
+)
+
+var (
+	// ErrPassphraseRequired means the vault is locked with a passphrase and none was given
+	ErrPassphraseRequired = errors.New("the credential vault is locked with a passphrase")
+	// ErrWrongKey means the vault could not be decrypted
+	ErrWrongKey = errors.New("wrong passphrase, or the vault was created on another machine or modified")
+)
+
+// Credential is one stored account
+type Credential struct {
+	Username  string    `json:"username"`
+	Password  string    `json:"password"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// file is the on-disk format, only the credentials are encrypted
+type file struct {
+	Version    int    `json:"version"`
+	Key        string `json:"key"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Data       []byte `json:"data"`
+}
+
+// payload is the decrypted content of a vault
+type payload struct {
+	Credentials []Credential `json:"credentials"`
+}
+
+// Vault is an unlocked credential vault
+type Vault struct {
+	Path string
+	Key  string // KeyPassphrase or KeyMachine
+
+	passphrase  string
+	credentials []Credential
+}
+
+// New creates an empty vault that is written to path on Save
+func New(path, key, passphrase string) (*Vault, error) {
+	v := &Vault{Path: path}
+	if err := v.SetKey(key, passphrase); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// KeySource returns the key source of the vault at path without unlocking it
+func KeySource(path string) (string, error) {
+	f, err := readFile(path)
+	if err != nil {
+		return "", err
+	}
+	return f.Key, nil
+}
+
+// Open unlocks the vault at path. The passphrase is ignored for machine-bound vaults.
+func Open(path, passphrase string) (*Vault, error) {
+	f, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if f.Key == KeyPassphrase && passphrase == "" {
+		return nil, ErrPassphraseRequired
+	}
+
+	secret, err := keySecret(f.Key, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(secret, f.Salt, f.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, f.Nonce, f.Data, f.additionalData())
+	if err != nil {
+		return nil, ErrWrongKey
+	}
+
+	var p payload
+	if err := json.Unmarshal(plaintext, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse credential vault: %w", err)
+	}
+
+	v := &Vault{Path: path, Key: f.Key, credentials: p.Credentials}
+	if f.Key == KeyPassphrase {
+		v.passphrase = passphrase
+	}
+	return v, nil
+}
+
+// SetKey changes the key source, the vault is re-encrypted on the next Save
+func (v *Vault) SetKey(key, passphrase string) error {
+	switch key {
+	case KeyMachine:
+		passphrase = ""
+	case KeyPassphrase:
+		if passphrase == "" {
+			return ErrPassphraseRequired
+		}
+	default:
+		return fmt.Errorf("unknown vault key source %q (expected %s or %s)", key, KeyPassphrase, KeyMachine)
+	}
+	v.Key = key
+	v.passphrase = passphrase
+	return nil
+}
+
+// Get returns the credential of username. An empty username selects the
+// only stored credential, if there is exactly one.
+func (v *Vault) Get(username string) (Credential, bool) {
+	if username == "" {
+		if len(v.credentials) == 1 {
+			return v.credentials[0], true
+		}
+		return Credential{}, false
+	}
+
+	for _, credential := range v.credentials {
+		if credential.Username == username {
+			return credential, true
+		}
+	}
+	return Credential{}, false
+}
+
+// Set stores the password of username, replacing an existing one
+func (v *Vault) Set(username, password string) {
+	credential := Credential{Username: username, Password: password, UpdatedAt: time.Now()}
+	for i := range v.credentials {
+		if v.credentials[i].Username == username {
+			v.credentials[i] = credential
+			return
+		}
+	}
+	v.credentials = append(v.credentials, credential)
+}
+
+// Remove deletes the credential of username and reports whether it existed
+func (v *Vault) Remove(username string) bool {
+	for i, credential := range v.credentials {
+		if credential.Username == username {
+			v.credentials = append(v.credentials[:i], v.credentials[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Credentials returns the stored credentials sorted by username
+func (v *Vault) Credentials() []Credential {
+	credentials := append([]Credential(nil), v.credentials...)
+	sort.Slice(credentials, func(i, j int) bool {
+		return credentials[i].Username < credentials[j].Username
+	})
+	return credentials
+}
+
+// Save encrypts the vault with a fresh salt and nonce and replaces the file atomically
+func (v *Vault) Save() error {
+	plaintext, err := json.Marshal(payload{Credentials: v.credentials})
+	if err != nil {
+		return fmt.Errorf("failed to encode credential vault: %w", err)
+	}
+
+	secret, err := keySecret(v.Key, v.passphrase)
+	if err != nil {
+		return err
+	}
+	f := file{Version: formatVersion, Key: v.Key, KDF: kdfName, Iterations: kdfIterations, Salt: make([]byte, 16)}
+	if _, err := rand.Read(f.Salt); err != nil {
+		return err
+	}
+	aead, err := newAEAD(secret, f.Salt, f.Iterations)
+	if err != nil {
+		return err
+	}
+	f.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(f.Nonce); err != nil {
+		return err
+	}
+	f.Data = aead.Seal(nil, f.Nonce, plaintext, f.additionalData())
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode credential vault: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(v.Path), 0700); err != nil {
+		return fmt.Errorf("failed to create vault directory: %w", err)
+	}
+
+	tmp := v.Path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write credential vault: %w", err)
+	}
+	if err := os.Rename(tmp, v.Path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write credential vault: %w", err)
+	}
+
+	return nil
+}
+
+// readFile reads and checks the on-disk format of a vault
+func readFile(path string) (*file, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse credential vault: %w", err)
+	}
+	if f.Version != formatVersion || f.KDF != kdfName {
+		return nil, fmt.Errorf("unsupported credential vault format %d/%s", f.Version, f.KDF)
+	}
+	return &f, nil
+}
+
+// additionalData binds the unencrypted header to the ciphertext
+func (f *file) additionalData() []byte {
+	return fmt.Appendf(nil, "ruijie-go vault %d %s %s %d", f.Version, f.Key, f.KDF, f.Iterations)
+}
+
+// keySecret returns the secret the encryption key is derived from
+func keySecret(key, passphrase string) (string, error) {
+	switch key {
+	case KeyPassphrase:
+		if passphrase == "" {
+			return "", ErrPassphraseRequired
+		}
+		return passphrase, nil
+	case KeyMachine:
+		return machineSecret()
+	default:
+		return "", fmt.Errorf("unknown vault key source %q", key)
+	}
+}
+
+// newAEAD derives the AES-256 key and returns its GCM cipher
+func newAEAD(secret string, salt []byte, iterations int) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, secret, salt, iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
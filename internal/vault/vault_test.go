@@ -0,0 +1,157 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// saveVault creates a vault at a new path holding one credential
+func saveVault(t *testing.T, key, passphrase string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "credentials.vault")
+	v, err := New(path, key, passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.Set("test", "secret")
+	if err := v.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	return path
+}
+
+// useMachineID makes the machine key depend on id instead of the real machine
+func useMachineID(t *testing.T, id string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "machine-id")
+	if err := os.WriteFile(path, []byte(id+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	saved := machineIDFiles
+	machineIDFiles = []string{path}
+	t.Cleanup(func() { machineIDFiles = saved })
+}
+
+func TestPassphraseRoundTrip(t *testing.T) {
+	path := saveVault(t, KeyPassphrase, "correct horse")
+
+	v, err := Open(path, "correct horse")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if credential, ok := v.Get("test"); !ok || credential.Password != "secret" {
+		t.Errorf("Get = %+v, %v, want the stored password", credential, ok)
+	}
+	if credential, ok := v.Get(""); !ok || credential.Username != "test" {
+		t.Errorf("Get without username = %+v, %v, want the only credential", credential, ok)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("vault mode = %o, want 600", mode)
+	}
+}
+
+func TestWrongPassphrase(t *testing.T) {
+	path := saveVault(t, KeyPassphrase, "correct horse")
+
+	if _, err := Open(path, "battery staple"); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("Open with a wrong passphrase = %v, want ErrWrongKey", err)
+	}
+	if _, err := Open(path, ""); !errors.Is(err, ErrPassphraseRequired) {
+		t.Errorf("Open without a passphrase = %v, want ErrPassphraseRequired", err)
+	}
+}
+
+func TestTamperedVault(t *testing.T) {
+	path := saveVault(t, KeyPassphrase, "correct horse")
+	f, err := readFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := newAEAD("correct horse", f.Salt, f.Iterations)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The header is not encrypted but bound to the ciphertext
+	tampered := *f
+	tampered.Iterations = 1000
+	if _, err := aead.Open(nil, f.Nonce, f.Data, tampered.additionalData()); err == nil {
+		t.Error("ciphertext opened with a tampered header")
+	}
+	if _, err := aead.Open(nil, f.Nonce, f.Data, f.additionalData()); err != nil {
+		t.Errorf("ciphertext did not open with its own header: %v", err)
+	}
+
+	// A flipped ciphertext bit is reported like a wrong key
+	f.Data[0] ^= 1
+	data, err := json.Marshal(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path, "correct horse"); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("Open of a modified vault = %v, want ErrWrongKey", err)
+	}
+}
+
+func TestMachineKey(t *testing.T) {
+	useMachineID(t, "0123456789abcdef")
+	path := saveVault(t, KeyMachine, "")
+
+	v, err := Open(path, "ignored")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if credential, ok := v.Get("test"); !ok || credential.Password != "secret" {
+		t.Errorf("Get = %+v, %v, want the stored password", credential, ok)
+	}
+	if key, err := KeySource(path); err != nil || key != KeyMachine {
+		t.Errorf("KeySource = %q, %v, want %q", key, err, KeyMachine)
+	}
+
+	// Copied to another machine the vault no longer opens
+	useMachineID(t, "fedcba9876543210")
+	if _, err := Open(path, ""); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("Open on another machine = %v, want ErrWrongKey", err)
+	}
+}
+
+func TestSaveIsAtomic(t *testing.T) {
+	path := saveVault(t, KeyPassphrase, "correct horse")
+	if _, err := os.Stat(path + ".tmp"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+
+	// A save that cannot write its temporary file leaves the vault untouched
+	if err := os.Mkdir(path+".tmp", 0700); err != nil {
+		t.Fatal(err)
+	}
+	v, err := Open(path, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.Set("test", "changed")
+	if err := v.Save(); err == nil {
+		t.Fatal("Save succeeded without its temporary file")
+	}
+
+	v, err = Open(path, "correct horse")
+	if err != nil {
+		t.Fatalf("Open after a failed save: %v", err)
+	}
+	if credential, _ := v.Get("test"); credential.Password != "secret" {
+		t.Errorf("password after a failed save = %q, want the old one", credential.Password)
+	}
+}
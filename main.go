@@ -5,11 +5,12 @@ import (
 	"os"
 
 	"ruijie-go/cmd"
+	"ruijie-go/internal/config"
 )
 
 func main() {
 	if err := cmd.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		os.Exit(config.ExitCode(err))
 	}
 }